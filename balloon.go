@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/mingram/trail/osm"
+	"github.com/mingram/trail/units"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+)
+
+// balloonText is the BalloonStyle text every KML style gets when
+// descriptions are HTML, the description carrying everything but the name.
+const balloonText = `<h3>$[name]</h3>$[description]`
+
+// defaultBalloon is the HTML description used for -balloon default.
+const defaultBalloon = `<div style="font-family: sans-serif; font-size: 13px; width: 320px">
+{{- if .Status}}
+<p style="background: {{.StatusColor}}; color: white; padding: 4px 6px"><b>{{.Status}}</b>{{if .StatusNote}}: {{.StatusNote}}{{end}}{{if .StatusUpdated}}<br><small>Updated {{.StatusUpdated}}</small>{{end}}</p>
+{{- end}}
+<p><b>{{.Type}}</b>{{if .Difficulty}} <span style="background: {{.Badge}}; color: white; border-radius: 3px; padding: 1px 6px">{{.Difficulty}}</span>{{end}}</p>
+<p>{{distance .Km}}{{if .HasClimb}}, {{height .Climb}} climb{{end}}{{if .Park}}<br>{{.Park}}{{end}}{{if .Segment}}<br>Segment {{.Segment}}{{end}}</p>
+{{- if .Profile}}
+<p><img src="{{.Profile}}" width="{{profileWidth}}" height="{{profileHeight}}" alt="Elevation profile"></p>
+{{- end}}
+<table style="border-collapse: collapse">
+{{- range .Tags}}
+<tr><td style="color: #666; padding-right: 8px">{{.Key}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+<p><a href="https://www.openstreetmap.org/way/{{.Way}}">View way {{.Way}} on OpenStreetMap</a>{{if .SyntheticName}}<br>Name generated, not tagged in OSM{{end}}</p>
+</div>`
+
+const (
+	profileWidth  = 300
+	profileHeight = 60
+)
+
+// balloonData adds to descriptionData what the HTML description shows.
+type balloonData struct {
+	descriptionData
+	Badge       string
+	StatusColor string
+	Tags        []openStreetMap.Tag
+	Profile     template.URL
+}
+
+// difficultyColors are badge colours for the mtb:scale and
+// piste:difficulty values, in the usual green, blue, black and red.
+var difficultyColors = map[string]string{
+	"0": "#2e7d32", "1": "#2e7d32", "novice": "#2e7d32", "easy": "#2e7d32",
+	"2": "#1565c0", "intermediate": "#1565c0",
+	"3": "#212121", "advanced": "#212121", "expert": "#212121",
+	"4": "#c62828", "5": "#c62828", "6": "#c62828", "freeride": "#c62828", "extreme": "#c62828",
+}
+
+// parseBalloon reads an HTML description template, default for the built
+// in one or @file for one in a file.
+func parseBalloon(text string, u units.Units) (*template.Template, error) {
+	if text == "default" {
+		text = defaultBalloon
+	} else if strings.HasPrefix(text, "@") {
+		b, err := ioutil.ReadFile(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	funcs := template.FuncMap(u.Funcs())
+	funcs["profileWidth"] = func() int { return profileWidth }
+	funcs["profileHeight"] = func() int { return profileHeight }
+	return template.New("balloon").Funcs(funcs).Parse(text)
+}
+
+func (opts exportOptions) balloonData(node []openStreetMap.Node) balloonData {
+	data := balloonData{descriptionData: opts.descriptionData(node)}
+	data.Badge = difficultyColors[data.Difficulty]
+	if data.Badge == "" {
+		data.Badge = "#757575"
+	}
+	data.StatusColor = "#757575"
+	if style, ok := conditionStyles[data.Status]; ok {
+		data.StatusColor = style.Color
+	}
+	data.Tags = append(data.Tags, node[0].WayTags...)
+	sort.Slice(data.Tags, func(i, j int) bool { return data.Tags[i].Key < data.Tags[j].Key })
+	data.Profile = opts.elevationProfile(node)
+	return data
+}
+
+// describeHTML runs the HTML description template for a trail.
+func (opts exportOptions) describeHTML(node []openStreetMap.Node) string {
+	var b strings.Builder
+	if err := opts.Balloon.Execute(&b, opts.balloonData(node)); err != nil {
+		log.Print(err)
+	}
+	return b.String()
+}
+
+// elevationProfile draws height against distance from the ele tags as a
+// small SVG, returned as a data URI. Empty unless two nodes have heights.
+func (opts exportOptions) elevationProfile(node []openStreetMap.Node) template.URL {
+	var along, heights []float64
+	km := 0.0
+	for i, nd := range node {
+		if i > 0 {
+			km += opts.trailLength(node[i-1 : i+1])
+		}
+		if ele, ok := nodeEle(nd); ok {
+			along = append(along, km)
+			heights = append(heights, ele)
+		}
+	}
+	if len(heights) < 2 || km == 0 {
+		return ""
+	}
+	low, high := heights[0], heights[0]
+	for _, h := range heights {
+		if h < low {
+			low = h
+		}
+		if h > high {
+			high = h
+		}
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	var points []string
+	var first, last float64
+	for i, h := range heights {
+		x := along[i] / km * profileWidth
+		if i == 0 {
+			first = x
+		}
+		last = x
+		y := profileHeight - 2 - (h-low)/(high-low)*(profileHeight-4)
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, profileWidth, profileHeight, profileWidth, profileHeight)
+	fmt.Fprintf(&svg, `<polygon points="%.1f,%d %s %.1f,%d" fill="#bbdefb"/>`, first, profileHeight, strings.Join(points, " "), last, profileHeight)
+	fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="#1565c0" stroke-width="1.5"/>`, strings.Join(points, " "))
+	svg.WriteString(`</svg>`)
+	return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(svg.Bytes()))
+}
@@ -0,0 +1,356 @@
+package clip
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/mingram/trail/osm"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Ring is a closed list of [lon, lat] points.
+type Ring [][]float64
+
+// Polygon is an outer ring followed by any holes.
+type Polygon []Ring
+
+// Area is a set of polygons that ways get clipped to.
+type Area struct {
+	Polygons []Polygon
+}
+
+func NewBBox(minLon float64, minLat float64, maxLon float64, maxLat float64) Area {
+	ring := Ring{{minLon, minLat}, {maxLon, minLat}, {maxLon, maxLat}, {minLon, maxLat}, {minLon, minLat}}
+	return Area{Polygons: []Polygon{{ring}}}
+}
+
+// ParseBBox reads "minLon,minLat,maxLon,maxLat".
+func ParseBBox(s string) (Area, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return Area{}, fmt.Errorf("bbox %q: want minLon,minLat,maxLon,maxLat", s)
+	}
+	var nums [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return Area{}, fmt.Errorf("bbox %q: %v", s, err)
+		}
+		nums[i] = f
+	}
+	if nums[0] >= nums[2] || nums[1] >= nums[3] {
+		return Area{}, fmt.Errorf("bbox %q: min must be less than max", s)
+	}
+	return NewBBox(nums[0], nums[1], nums[2], nums[3]), nil
+}
+
+// ReadFile loads the polygons from a GeoJSON or KML file.
+func ReadFile(file string) (Area, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Area{}, err
+	}
+	defer f.Close()
+
+	var area Area
+	if strings.ToLower(filepath.Ext(file)) == ".kml" {
+		area, err = ReadKML(f)
+	} else {
+		area, err = ReadGeoJSON(f)
+	}
+	if err != nil {
+		return Area{}, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(area.Polygons) == 0 {
+		return Area{}, fmt.Errorf("%s: no polygons found", file)
+	}
+	return area, nil
+}
+
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Features    []geoJSON       `json:"features"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Geometries  []geoJSON       `json:"geometries"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+func ReadGeoJSON(r io.Reader) (Area, error) {
+	byteValue, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Area{}, err
+	}
+	var doc geoJSON
+	if err := json.Unmarshal(byteValue, &doc); err != nil {
+		return Area{}, err
+	}
+	var area Area
+	err = area.addGeoJSON(doc)
+	return area, err
+}
+
+func (area *Area) addGeoJSON(doc geoJSON) error {
+	switch doc.Type {
+	case "FeatureCollection":
+		for _, feature := range doc.Features {
+			if err := area.addGeoJSON(feature); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if doc.Geometry != nil {
+			return area.addGeoJSON(*doc.Geometry)
+		}
+	case "GeometryCollection":
+		for _, geometry := range doc.Geometries {
+			if err := area.addGeoJSON(geometry); err != nil {
+				return err
+			}
+		}
+	case "Polygon":
+		var polygon Polygon
+		if err := json.Unmarshal(doc.Coordinates, &polygon); err != nil {
+			return err
+		}
+		area.Polygons = append(area.Polygons, polygon)
+	case "MultiPolygon":
+		var polygons []Polygon
+		if err := json.Unmarshal(doc.Coordinates, &polygons); err != nil {
+			return err
+		}
+		area.Polygons = append(area.Polygons, polygons...)
+	}
+	return nil
+}
+
+type kmlPolygon struct {
+	Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+// ReadKML collects every <Polygon> in the document, wherever it is nested.
+func ReadKML(r io.Reader) (Area, error) {
+	var area Area
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Area{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Polygon" {
+			continue
+		}
+		var p kmlPolygon
+		if err := decoder.DecodeElement(&p, &start); err != nil {
+			return Area{}, err
+		}
+		polygon := Polygon{parseKMLCoords(p.Outer)}
+		for _, inner := range p.Inner {
+			polygon = append(polygon, parseKMLCoords(inner))
+		}
+		area.Polygons = append(area.Polygons, polygon)
+	}
+	return area, nil
+}
+
+func parseKMLCoords(coords string) Ring {
+	var ring Ring
+	for _, co := range strings.Fields(coords) {
+		coms := strings.Split(co, ",")
+		if len(coms) < 2 {
+			continue
+		}
+		lon, err1 := strconv.ParseFloat(coms[0], 64)
+		lat, err2 := strconv.ParseFloat(coms[1], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		ring = append(ring, []float64{lon, lat})
+	}
+	return ring
+}
+
+// Contains uses the even-odd rule, so holes are excluded.
+func (area Area) Contains(lon float64, lat float64) bool {
+	for _, polygon := range area.Polygons {
+		inside := false
+		for _, ring := range polygon {
+			if ring.contains(lon, lat) {
+				inside = !inside
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+func (ring Ring) contains(lon float64, lat float64) bool {
+	inside := false
+	n := len(ring)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// crossings returns where the segment a-b crosses a boundary, as fractions
+// of the way from a to b, sorted.
+func (area Area) crossings(a []float64, b []float64) []float64 {
+	var ts []float64
+	for _, polygon := range area.Polygons {
+		for _, ring := range polygon {
+			for i := 0; i+1 < len(ring); i++ {
+				if t, ok := intersect(a, b, ring[i], ring[i+1]); ok {
+					ts = append(ts, t)
+				}
+			}
+			if n := len(ring); n > 2 && !samePoint(ring[0], ring[n-1]) {
+				if t, ok := intersect(a, b, ring[n-1], ring[0]); ok {
+					ts = append(ts, t)
+				}
+			}
+		}
+	}
+	sort.Float64s(ts)
+	// a way that touches a ring vertex from the left meets both edges
+	// there without crossing, and the two cancel out
+	var kept []float64
+	for _, t := range ts {
+		if n := len(kept); n > 0 && kept[n-1] == t {
+			kept = kept[:n-1]
+			continue
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
+
+func samePoint(a []float64, b []float64) bool {
+	return a[0] == b[0] && a[1] == b[1]
+}
+
+// intersect finds where a-b crosses the ring edge c-d. The edge counts
+// only when its ends are on opposite sides of the line through a and b,
+// an end on the line counting as right of it, so a way through a ring
+// vertex crosses once and one touching a vertex crosses zero or two times.
+func intersect(a []float64, b []float64, c []float64, d []float64) (float64, bool) {
+	rx, ry := b[0]-a[0], b[1]-a[1]
+	side := func(p []float64) float64 {
+		return rx*(p[1]-a[1]) - ry*(p[0]-a[0])
+	}
+	sc, sd := side(c), side(d)
+	if (sc > 0) == (sd > 0) {
+		return 0, false
+	}
+	var t float64
+	switch {
+	case sc == 0:
+		t = along(a, b, c)
+	case sd == 0:
+		t = along(a, b, d)
+	default:
+		sx, sy := d[0]-c[0], d[1]-c[1]
+		qx, qy := c[0]-a[0], c[1]-a[1]
+		t = (qx*sy - qy*sx) / (rx*sy - ry*sx)
+	}
+	if t <= 0 || t >= 1 {
+		return 0, false
+	}
+	return t, true
+}
+
+// along is how far p, which is on the line through a and b, is from a to
+// b. Working it out the same way for every edge meeting at a vertex gives
+// exactly the same fraction for each.
+func along(a []float64, b []float64, p []float64) float64 {
+	rx, ry := b[0]-a[0], b[1]-a[1]
+	return ((p[0]-a[0])*rx + (p[1]-a[1])*ry) / (rx*rx + ry*ry)
+}
+
+// Clip cuts every way in osm down to the parts inside the area. A way that
+// leaves and re-enters the area is split into several ways sharing the
+// original id. Boundary crossings become new nodes with negative ids, the
+// same convention OSM editors use for objects that are not uploaded yet,
+// numbered on from the lowest already in osm so clipping twice never reuses
+// one.
+func (area Area) Clip(osm *openStreetMap.Osm) {
+	nodes := make(map[string]openStreetMap.Node, len(osm.Nodes))
+	// carry on below any negative ids already used, by the editor the
+	// extract came from or an earlier clip
+	lowest := int64(0)
+	for _, node := range osm.Nodes {
+		nodes[node.Id] = node
+		if id, err := strconv.ParseInt(node.Id, 10, 64); err == nil && id < lowest {
+			lowest = id
+		}
+	}
+	var ways []openStreetMap.Way
+	var newNodes []openStreetMap.Node
+	addNode := func(a openStreetMap.Node, b openStreetMap.Node, t float64) openStreetMap.Nd {
+		node := openStreetMap.Node{
+			Id:      strconv.FormatInt(lowest-int64(len(newNodes))-1, 10),
+			Visible: true,
+			Lon:     a.Lon + (b.Lon-a.Lon)*t,
+			Lat:     a.Lat + (b.Lat-a.Lat)*t,
+		}
+		newNodes = append(newNodes, node)
+		return openStreetMap.Nd{Ref: node.Id}
+	}
+
+	for _, way := range osm.Ways {
+		var parts [][]openStreetMap.Nd
+		var current []openStreetMap.Nd
+		var prev openStreetMap.Node
+		var inside bool
+		for _, nd := range way.Nds {
+			node, ok := nodes[nd.Ref]
+			if !ok {
+				continue
+			}
+			if prev.Id == "" {
+				inside = area.Contains(node.Lon, node.Lat)
+			} else {
+				for _, t := range area.crossings([]float64{prev.Lon, prev.Lat}, []float64{node.Lon, node.Lat}) {
+					current = append(current, addNode(prev, node, t))
+					if inside {
+						parts = append(parts, current)
+						current = nil
+					}
+					inside = !inside
+				}
+			}
+			if inside {
+				current = append(current, nd)
+			}
+			prev = node
+		}
+		parts = append(parts, current)
+
+		for _, part := range parts {
+			if len(part) < 2 {
+				continue
+			}
+			piece := way
+			piece.Nds = part
+			ways = append(ways, piece)
+		}
+	}
+	osm.Ways = ways
+	osm.Nodes = append(osm.Nodes, newNodes...)
+}
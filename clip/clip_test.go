@@ -0,0 +1,159 @@
+package clip
+
+import (
+	"github.com/mingram/trail/osm"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// extract makes an Osm of numbered nodes at the given points and one way,
+// w, through them in order.
+func extract(points ...[]float64) openStreetMap.Osm {
+	var osm openStreetMap.Osm
+	way := openStreetMap.Way{Id: "w"}
+	for i, p := range points {
+		id := strconv.Itoa(i + 1)
+		osm.Nodes = append(osm.Nodes, openStreetMap.Node{Id: id, Lon: p[0], Lat: p[1]})
+		way.Nds = append(way.Nds, openStreetMap.Nd{Ref: id})
+	}
+	osm.Ways = []openStreetMap.Way{way}
+	return osm
+}
+
+// clipped lists the node ids of each way left and the position of every
+// node clipping added.
+func clipped(area Area, osm openStreetMap.Osm) ([][]string, map[string][]float64) {
+	before := len(osm.Nodes)
+	area.Clip(&osm)
+	var ways [][]string
+	for _, way := range osm.Ways {
+		var ids []string
+		for _, nd := range way.Nds {
+			ids = append(ids, nd.Ref)
+		}
+		ways = append(ways, ids)
+	}
+	added := make(map[string][]float64)
+	for _, node := range osm.Nodes[before:] {
+		added[node.Id] = []float64{node.Lon, node.Lat}
+	}
+	return ways, added
+}
+
+func TestClipBBox(t *testing.T) {
+	box := NewBBox(0, 0, 10, 10)
+	tests := []struct {
+		name  string
+		osm   openStreetMap.Osm
+		ways  [][]string
+		added map[string][]float64
+	}{
+		{
+			name: "inside",
+			osm:  extract([]float64{1, 1}, []float64{2, 2}),
+			ways: [][]string{{"1", "2"}},
+		},
+		{
+			name: "outside",
+			osm:  extract([]float64{11, 1}, []float64{12, 2}),
+		},
+		{
+			name:  "leaves",
+			osm:   extract([]float64{5, 5}, []float64{15, 5}),
+			ways:  [][]string{{"1", "-1"}},
+			added: map[string][]float64{"-1": {10, 5}},
+		},
+		{
+			name:  "leaves and comes back",
+			osm:   extract([]float64{5, 5}, []float64{15, 5}, []float64{15, 6}, []float64{5, 6}),
+			ways:  [][]string{{"1", "-1"}, {"-2", "4"}},
+			added: map[string][]float64{"-1": {10, 5}, "-2": {10, 6}},
+		},
+		{
+			name:  "passes through",
+			osm:   extract([]float64{-5, 5}, []float64{15, 5}),
+			ways:  [][]string{{"-1", "-2"}},
+			added: map[string][]float64{"-1": {0, 5}, "-2": {10, 5}},
+		},
+		{
+			// a way through a corner crosses both edges at once
+			name:  "through a corner",
+			osm:   extract([]float64{-5, -5}, []float64{5, 5}),
+			ways:  [][]string{{"-1", "2"}},
+			added: map[string][]float64{"-1": {0, 0}},
+		},
+		{
+			name: "touches a corner",
+			osm:  extract([]float64{-5, 5}, []float64{5, -5}),
+		},
+	}
+	for _, test := range tests {
+		ways, added := clipped(box, test.osm)
+		if !reflect.DeepEqual(ways, test.ways) {
+			t.Errorf("%s: ways = %v, want %v", test.name, ways, test.ways)
+		}
+		if len(added) != len(test.added) {
+			t.Errorf("%s: added nodes %v, want %v", test.name, added, test.added)
+		}
+		for id, want := range test.added {
+			if got, ok := added[id]; !ok || !near(got, want) {
+				t.Errorf("%s: node %s at %v, want %v", test.name, id, got, want)
+			}
+		}
+	}
+}
+
+func near(a []float64, b []float64) bool {
+	const tolerance = 1e-9
+	return a[0]-b[0] < tolerance && b[0]-a[0] < tolerance && a[1]-b[1] < tolerance && b[1]-a[1] < tolerance
+}
+
+func TestClipVertexTouch(t *testing.T) {
+	diamond := Area{Polygons: []Polygon{{Ring{{5, 0}, {10, 5}, {5, 10}, {0, 5}, {5, 0}}}}}
+	tests := []struct {
+		name string
+		osm  openStreetMap.Osm
+		ways [][]string
+	}{
+		// the top vertex is touched with the diamond on either side of the
+		// way, and the way stays outside both times
+		{"touches going east", extract([]float64{0, 10}, []float64{10, 10}), nil},
+		{"touches going west", extract([]float64{10, 10}, []float64{0, 10}), nil},
+		{"crosses at a vertex", extract([]float64{5, 12}, []float64{5, 8}), [][]string{{"-1", "2"}}},
+		{"through two vertices", extract([]float64{-1, 5}, []float64{11, 5}), [][]string{{"-1", "-2"}}},
+		// leaving through a vertex and coming back through another
+		{"out and back", extract([]float64{5, 5}, []float64{12, 5}, []float64{5, 12}, []float64{5, 6}), [][]string{{"1", "-1"}, {"-2", "4"}}},
+	}
+	for _, test := range tests {
+		ways, _ := clipped(diamond, test.osm)
+		if !reflect.DeepEqual(ways, test.ways) {
+			t.Errorf("%s: ways = %v, want %v", test.name, ways, test.ways)
+		}
+	}
+}
+
+func TestClipNewNodeIds(t *testing.T) {
+	box := NewBBox(0, 0, 10, 10)
+	osm := extract([]float64{5, 5}, []float64{15, 5}, []float64{15, 6}, []float64{5, 6})
+	// an id an editor gave an object not yet uploaded
+	osm.Nodes = append(osm.Nodes, openStreetMap.Node{Id: "-5", Lon: 20, Lat: 20})
+	ways, added := clipped(box, osm)
+	if want := [][]string{{"1", "-6"}, {"-7", "4"}}; !reflect.DeepEqual(ways, want) {
+		t.Errorf("ways = %v, want %v", ways, want)
+	}
+	if len(added) != 2 || added["-6"] == nil || added["-7"] == nil {
+		t.Errorf("added nodes %v, want -6 and -7", added)
+	}
+
+	// clipping again to a smaller box carries on below them
+	osm = extract([]float64{5, 5}, []float64{15, 5})
+	box.Clip(&osm)
+	ways, added = clipped(NewBBox(0, 0, 8, 10), osm)
+	if want := [][]string{{"1", "-2"}}; !reflect.DeepEqual(ways, want) {
+		t.Errorf("second clip ways = %v, want %v", ways, want)
+	}
+	if got := added["-2"]; got == nil || !near(got, []float64{8, 5}) {
+		t.Errorf("second clip added %v, want -2 at 8,5", added)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/mingram/trail/columnar"
+	"github.com/mingram/trail/osm"
+	"reflect"
+	"strings"
+)
+
+// propertyColumns are the columns for the json tags on Properties, and
+// whether each is left out of GeoJSON when empty.
+func propertyColumns() ([]columnar.Column, []bool) {
+	var columns []columnar.Column
+	var omitEmpty []bool
+	t := reflect.TypeOf(Properties{})
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		column := columnar.Column{Name: tag[0], Type: columnar.String}
+		switch t.Field(i).Type.Kind() {
+		case reflect.Float64:
+			column.Type = columnar.Double
+		case reflect.Bool:
+			column.Type = columnar.Bool
+		}
+		columns = append(columns, column)
+		omitEmpty = append(omitEmpty, len(tag) > 1 && tag[1] == "omitempty")
+	}
+	return columns, omitEmpty
+}
+
+// propertyValues are the properties in column order, nil for those GeoJSON
+// would leave out.
+func propertyValues(properties Properties, omitEmpty []bool) []interface{} {
+	v := reflect.ValueOf(properties)
+	var values []interface{}
+	for i := 0; i < v.NumField(); i++ {
+		if omitEmpty[i] && v.Field(i).IsZero() {
+			values = append(values, nil)
+		} else {
+			values = append(values, v.Field(i).Interface())
+		}
+	}
+	return values
+}
+
+// trailColumns turns the GeoJSON features into columns and rows. Columns
+// come from the json tags on Properties, so the FlatGeobuf and GeoParquet
+// attributes always match the GeoJSON ones; a property GeoJSON would leave
+// out is null.
+func (opts exportOptions) trailColumns(nodes [][]openStreetMap.Node) ([]columnar.Column, []columnar.Feature) {
+	columns, omitEmpty := propertyColumns()
+	var features []columnar.Feature
+	for _, node := range nodes {
+		feature := opts.trailFeature(node)
+		values := propertyValues(feature.Properties, omitEmpty)
+		features = append(features, columnar.Feature{Coordinates: feature.Geometry.Coordinates, Values: values})
+	}
+	return columns, features
+}
+
+// writeColumnar saves the trails as FlatGeobuf and/or GeoParquet for the
+// analytics pipeline. Either file may be empty to skip it.
+func (opts exportOptions) writeColumnar(fgbFile string, parquetFile string, nodes [][]openStreetMap.Node) error {
+	columns, features := opts.trailColumns(nodes)
+	if fgbFile != "" {
+		if err := columnar.WriteFlatGeobuf(fgbFile, "trails", columns, features); err != nil {
+			return err
+		}
+	}
+	if parquetFile != "" {
+		return columnar.WriteGeoParquet(parquetFile, columns, features)
+	}
+	return nil
+}
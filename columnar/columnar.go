@@ -0,0 +1,64 @@
+package columnar
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Column types. Values are string, float64 and bool respectively, or nil
+// when a feature has no value for the column.
+const (
+	String = "string"
+	Double = "double"
+	Bool   = "bool"
+)
+
+type Column struct {
+	Name string
+	Type string
+}
+
+// Feature is one line of [lon, lat] points and its values in column order.
+type Feature struct {
+	Coordinates [][]float64
+	Values      []interface{}
+}
+
+// bounds returns minLon, minLat, maxLon, maxLat of the points.
+func bounds(points [][]float64) [4]float64 {
+	b := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range points {
+		b[0], b[1] = math.Min(b[0], p[0]), math.Min(b[1], p[1])
+		b[2], b[3] = math.Max(b[2], p[0]), math.Max(b[3], p[1])
+	}
+	return b
+}
+
+func extend(b *[4]float64, other [4]float64) {
+	b[0], b[1] = math.Min(b[0], other[0]), math.Min(b[1], other[1])
+	b[2], b[3] = math.Max(b[2], other[2]), math.Max(b[3], other[3])
+}
+
+// totalBounds covers every feature, or is all zero when there are none.
+func totalBounds(features []Feature) [4]float64 {
+	if len(features) == 0 {
+		return [4]float64{}
+	}
+	b := bounds(nil)
+	for _, feature := range features {
+		extend(&b, bounds(feature.Coordinates))
+	}
+	return b
+}
+
+// wkb encodes a little endian WKB LineString.
+func wkb(points [][]float64) []byte {
+	b := []byte{1}
+	b = binary.LittleEndian.AppendUint32(b, 2)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(points)))
+	for _, p := range points {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[0]))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[1]))
+	}
+	return b
+}
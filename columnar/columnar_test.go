@@ -0,0 +1,331 @@
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/parquet-go/parquet-go"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testColumns = []Column{
+	{Name: "name", Type: String},
+	{Name: "length", Type: Double},
+	{Name: "closed", Type: Bool},
+}
+
+// testFeatures is enough lines for the R-tree to have a level between the
+// root and the leaves, with gaps in the values so optional columns get
+// nulls.
+func testFeatures() []Feature {
+	var features []Feature
+	for i := 0; i < 40; i++ {
+		lon, lat := -77.5+float64(i%8)*0.01, 39.6+float64(i/8)*0.01
+		feature := Feature{
+			Coordinates: [][]float64{{lon, lat}, {lon + 0.005, lat + 0.002}, {lon + 0.007, lat - 0.001}},
+			Values:      []interface{}{string(rune('A'+i%26)) + "trail", float64(i) * 0.5, i%3 == 0},
+		}
+		if i%5 == 0 {
+			feature.Values[1] = nil
+		}
+		if i%7 == 0 {
+			feature.Values[0] = nil
+		}
+		features = append(features, feature)
+	}
+	return features
+}
+
+// fbSlot is where the vtable keeps the offset of field id.
+func fbSlot(id int) flatbuffers.VOffsetT {
+	return flatbuffers.VOffsetT(4 + 2*id)
+}
+
+// fbOffset is the offset of field id from the start of the table, 0 if it
+// is not set, as the vector accessors take it.
+func fbOffset(t *flatbuffers.Table, id int) flatbuffers.UOffsetT {
+	return flatbuffers.UOffsetT(t.Offset(fbSlot(id)))
+}
+
+func fbTableAt(t *flatbuffers.Table, id int) *flatbuffers.Table {
+	return &flatbuffers.Table{Bytes: t.Bytes, Pos: t.Indirect(t.Pos + fbOffset(t, id))}
+}
+
+func fbStringAt(t *flatbuffers.Table, id int) string {
+	return t.String(t.Pos + fbOffset(t, id))
+}
+
+func fbFloat64s(t *flatbuffers.Table, id int) []float64 {
+	o := fbOffset(t, id)
+	var values []float64
+	start := t.Vector(o)
+	for i := 0; i < t.VectorLen(o); i++ {
+		values = append(values, t.GetFloat64(start+flatbuffers.UOffsetT(8*i)))
+	}
+	return values
+}
+
+// sizePrefixed reads the root table of a size prefixed buffer at the start
+// of b, returning it and how long the buffer is.
+func sizePrefixed(b []byte) (*flatbuffers.Table, int) {
+	size := int(binary.LittleEndian.Uint32(b))
+	buf := b[:4+size]
+	return &flatbuffers.Table{Bytes: buf, Pos: 4 + flatbuffers.GetUOffsetT(buf[4:])}, 4 + size
+}
+
+func TestFlatGeobufRoundTrip(t *testing.T) {
+	features := testFeatures()
+	file := filepath.Join(t.TempDir(), "trails.fgb")
+	if err := WriteFlatGeobuf(file, "trails", testColumns, features); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:8], fgbMagic) {
+		t.Fatalf("magic = %v", b[:8])
+	}
+	b = b[8:]
+
+	header, size := sizePrefixed(b)
+	b = b[size:]
+	if name := fbStringAt(header, 0); name != "trails" {
+		t.Errorf("name = %q, want trails", name)
+	}
+	extent := totalBounds(features)
+	if envelope := fbFloat64s(header, 1); !reflect.DeepEqual(envelope, extent[:]) {
+		t.Errorf("envelope = %v, want %v", envelope, extent)
+	}
+	if kind := header.GetUint8Slot(fbSlot(2), 0); kind != fgbLineString {
+		t.Errorf("geometry type = %d, want %d", kind, fgbLineString)
+	}
+	columns := fbOffset(header, 7)
+	if n := header.VectorLen(columns); n != len(testColumns) {
+		t.Fatalf("%d columns, want %d", n, len(testColumns))
+	}
+	for i, want := range testColumns {
+		element := header.Vector(columns) + flatbuffers.UOffsetT(4*i)
+		column := &flatbuffers.Table{Bytes: header.Bytes, Pos: header.Indirect(element)}
+		if name := fbStringAt(column, 0); name != want.Name {
+			t.Errorf("column %d name = %q, want %q", i, name, want.Name)
+		}
+		if kind := column.GetUint8Slot(fbSlot(1), 0); kind != fgbTypes[want.Type] {
+			t.Errorf("column %d type = %d, want %d", i, kind, fgbTypes[want.Type])
+		}
+	}
+	if count := header.GetUint64Slot(fbSlot(8), 0); count != uint64(len(features)) {
+		t.Errorf("features count = %d, want %d", count, len(features))
+	}
+	// 16 is the schema's default
+	if size := header.GetUint16Slot(fbSlot(9), 16); size != nodeSize {
+		t.Errorf("index node size = %d, want %d", size, nodeSize)
+	}
+	crs := fbTableAt(header, 10)
+	if code := crs.GetInt32Slot(fbSlot(1), 0); code != 4326 {
+		t.Errorf("crs code = %d, want 4326", code)
+	}
+
+	// 40 leaves under 3 inner nodes under the root
+	const nodes = 40 + 3 + 1
+	type nodeItem struct {
+		Box    [4]float64
+		Offset uint64
+	}
+	items := make([]nodeItem, nodes)
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, items); err != nil {
+		t.Fatal(err)
+	}
+	b = b[nodes*40:]
+	if items[0].Box != extent {
+		t.Errorf("root box = %v, want %v", items[0].Box, extent)
+	}
+	for i := 1; i <= 3; i++ {
+		if want := uint64(4 + (i-1)*nodeSize); items[i].Offset != want {
+			t.Errorf("inner node %d points at %d, want %d", i, items[i].Offset, want)
+		}
+	}
+
+	// every leaf points at a feature inside its box
+	var read []Feature
+	for _, leaf := range items[4:] {
+		feature, _ := sizePrefixed(b[leaf.Offset:])
+		geometry := fbTableAt(feature, 0)
+		if kind := geometry.GetUint8Slot(fbSlot(6), 0); kind != fgbLineString {
+			t.Errorf("feature geometry type = %d, want %d", kind, fgbLineString)
+		}
+		xy := fbFloat64s(geometry, 1)
+		var points [][]float64
+		for i := 0; i < len(xy); i += 2 {
+			points = append(points, []float64{xy[i], xy[i+1]})
+		}
+		if box := bounds(points); box != leaf.Box {
+			t.Errorf("leaf box = %v, feature box = %v", leaf.Box, box)
+		}
+
+		values := make([]interface{}, len(testColumns))
+		o := fbOffset(feature, 1)
+		properties := feature.Bytes[feature.Vector(o) : feature.Vector(o)+flatbuffers.UOffsetT(feature.VectorLen(o))]
+		for len(properties) > 0 {
+			i := binary.LittleEndian.Uint16(properties)
+			properties = properties[2:]
+			switch testColumns[i].Type {
+			case String:
+				n := binary.LittleEndian.Uint32(properties)
+				values[i] = string(properties[4 : 4+n])
+				properties = properties[4+n:]
+			case Double:
+				values[i] = math.Float64frombits(binary.LittleEndian.Uint64(properties))
+				properties = properties[8:]
+			case Bool:
+				values[i] = properties[0] != 0
+				properties = properties[1:]
+			}
+		}
+		read = append(read, Feature{Coordinates: points, Values: values})
+	}
+	checkFeatures(t, read, features)
+}
+
+func TestGeoParquetRoundTrip(t *testing.T) {
+	features := testFeatures()
+	file := filepath.Join(t.TempDir(), "trails.parquet")
+	if err := WriteGeoParquet(file, testColumns, features); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := pf.NumRows(); rows != int64(len(features)) {
+		t.Errorf("%d rows, want %d", rows, len(features))
+	}
+
+	geo, ok := pf.Lookup("geo")
+	if !ok {
+		t.Fatal("no geo metadata")
+	}
+	var metadata struct {
+		Version       string `json:"version"`
+		PrimaryColumn string `json:"primary_column"`
+		Columns       map[string]struct {
+			Encoding string     `json:"encoding"`
+			Bbox     [4]float64 `json:"bbox"`
+		} `json:"columns"`
+	}
+	if err := json.Unmarshal([]byte(geo), &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.PrimaryColumn != "geometry" || metadata.Columns["geometry"].Encoding != "WKB" {
+		t.Errorf("geo metadata = %s", geo)
+	}
+	if bbox := metadata.Columns["geometry"].Bbox; bbox != totalBounds(features) {
+		t.Errorf("bbox = %v, want %v", bbox, totalBounds(features))
+	}
+
+	// the index of each parquet column in testColumns, -1 for geometry
+	var names []string
+	var index []int
+	for _, path := range pf.Schema().Columns() {
+		names = append(names, path[0])
+		index = append(index, -1)
+		for i, column := range testColumns {
+			if column.Name == path[0] {
+				index[len(index)-1] = i
+			}
+		}
+	}
+	if want := []string{"closed", "geometry", "length", "name"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("columns = %v, want %v", names, want)
+	}
+
+	var read []Feature
+	for _, group := range pf.RowGroups() {
+		rows := group.Rows()
+		buf := make([]parquet.Row, 16)
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				feature := Feature{Values: make([]interface{}, len(testColumns))}
+				for _, value := range row {
+					if value.IsNull() {
+						continue
+					}
+					i := index[value.Column()]
+					if i < 0 {
+						feature.Coordinates = readWKB(t, value.ByteArray())
+						continue
+					}
+					switch testColumns[i].Type {
+					case String:
+						feature.Values[i] = string(value.ByteArray())
+					case Double:
+						feature.Values[i] = value.Double()
+					case Bool:
+						feature.Values[i] = value.Boolean()
+					}
+				}
+				read = append(read, feature)
+			}
+			if err != nil {
+				break
+			}
+		}
+		rows.Close()
+	}
+	checkFeatures(t, read, features)
+}
+
+func readWKB(t *testing.T, b []byte) [][]float64 {
+	if b[0] != 1 || binary.LittleEndian.Uint32(b[1:]) != 2 {
+		t.Fatalf("not a little endian WKB LineString: %v", b[:5])
+	}
+	n := int(binary.LittleEndian.Uint32(b[5:]))
+	var points [][]float64
+	for i := 0; i < n; i++ {
+		p := b[9+16*i:]
+		points = append(points, []float64{
+			math.Float64frombits(binary.LittleEndian.Uint64(p)),
+			math.Float64frombits(binary.LittleEndian.Uint64(p[8:])),
+		})
+	}
+	return points
+}
+
+// checkFeatures compares features read back with those written, in any
+// order since FlatGeobuf sorts them along the Hilbert curve.
+func checkFeatures(t *testing.T, read []Feature, written []Feature) {
+	t.Helper()
+	if len(read) != len(written) {
+		t.Fatalf("read %d features, want %d", len(read), len(written))
+	}
+	left := append([]Feature(nil), written...)
+	for _, feature := range read {
+		found := false
+		for i, want := range left {
+			if reflect.DeepEqual(feature, want) {
+				left = append(left[:i], left[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("read feature %v was not written", feature)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"io/ioutil"
+	"math"
+	"sort"
+)
+
+var fgbMagic = []byte{'f', 'g', 'b', 3, 'f', 'g', 'b', 1}
+
+const (
+	fgbLineString = 2
+
+	fgbBool   = 2
+	fgbDouble = 10
+	fgbString = 11
+
+	// nodeSize is the branching factor of the packed R-tree, the default
+	// every FlatGeobuf library uses
+	nodeSize = 16
+)
+
+var fgbTypes = map[string]uint8{Bool: fgbBool, Double: fgbDouble, String: fgbString}
+
+// WriteFlatGeobuf saves the features as a FlatGeobuf LineString layer with a
+// packed Hilbert R-tree index, so readers can fetch a bbox without scanning
+// the whole file.
+func WriteFlatGeobuf(file string, name string, columns []Column, features []Feature) error {
+	boxes := make([][4]float64, len(features))
+	for i, feature := range features {
+		boxes[i] = bounds(feature.Coordinates)
+	}
+	extent := totalBounds(features)
+	order := hilbertOrder(boxes, extent)
+
+	var data bytes.Buffer
+	offsets := make([]uint64, len(features))
+	for _, i := range order {
+		offsets[i] = uint64(data.Len())
+		data.Write(fgbFeature(columns, features[i]))
+	}
+
+	var out bytes.Buffer
+	out.Write(fgbMagic)
+	out.Write(fgbHeader(name, columns, len(features), extent))
+	if len(features) > 0 {
+		out.Write(packedRTree(boxes, offsets, order))
+	}
+	out.Write(data.Bytes())
+	return ioutil.WriteFile(file, out.Bytes(), 0644)
+}
+
+// Header and Feature field slots, from the FlatGeobuf schema
+const (
+	headerName          = 0
+	headerEnvelope      = 1
+	headerGeometryType  = 2
+	headerColumns       = 7
+	headerFeaturesCount = 8
+	headerIndexNodeSize = 9
+	headerCrs           = 10
+
+	columnName = 0
+	columnType = 1
+
+	crsOrg  = 0
+	crsCode = 1
+
+	featureGeometry   = 0
+	featureProperties = 1
+
+	geometryXY   = 1
+	geometryType = 6
+)
+
+func fgbHeader(name string, columns []Column, count int, extent [4]float64) []byte {
+	b := flatbuffers.NewBuilder(1024)
+	var cols []flatbuffers.UOffsetT
+	for _, column := range columns {
+		s := b.CreateString(column.Name)
+		b.StartObject(11)
+		b.PrependUOffsetTSlot(columnName, s, 0)
+		b.PrependUint8Slot(columnType, fgbTypes[column.Type], 0)
+		cols = append(cols, b.EndObject())
+	}
+	columnVector := b.CreateVectorOfTables(cols)
+	envelope := float64s(b, extent[:])
+	org := b.CreateString("EPSG")
+	b.StartObject(6)
+	b.PrependUOffsetTSlot(crsOrg, org, 0)
+	b.PrependInt32Slot(crsCode, 4326, 0)
+	crs := b.EndObject()
+	title := b.CreateString(name)
+
+	indexNodeSize := uint16(nodeSize)
+	if count == 0 {
+		indexNodeSize = 0
+	}
+	b.StartObject(14)
+	b.PrependUOffsetTSlot(headerName, title, 0)
+	b.PrependUOffsetTSlot(headerEnvelope, envelope, 0)
+	b.PrependUint8Slot(headerGeometryType, fgbLineString, 0)
+	b.PrependUOffsetTSlot(headerColumns, columnVector, 0)
+	b.PrependUint64Slot(headerFeaturesCount, uint64(count), 0)
+	// the schema's default is 16, so only 0 for no index is written
+	b.PrependUint16Slot(headerIndexNodeSize, indexNodeSize, 16)
+	b.PrependUOffsetTSlot(headerCrs, crs, 0)
+	b.FinishSizePrefixed(b.EndObject())
+	return b.FinishedBytes()
+}
+
+func fgbFeature(columns []Column, feature Feature) []byte {
+	var properties []byte
+	for i := range columns {
+		if i >= len(feature.Values) || feature.Values[i] == nil {
+			continue
+		}
+		properties = binary.LittleEndian.AppendUint16(properties, uint16(i))
+		switch v := feature.Values[i].(type) {
+		case string:
+			properties = binary.LittleEndian.AppendUint32(properties, uint32(len(v)))
+			properties = append(properties, v...)
+		case float64:
+			properties = binary.LittleEndian.AppendUint64(properties, math.Float64bits(v))
+		case bool:
+			if v {
+				properties = append(properties, 1)
+			} else {
+				properties = append(properties, 0)
+			}
+		}
+	}
+
+	b := flatbuffers.NewBuilder(1024)
+	var xy []float64
+	for _, p := range feature.Coordinates {
+		xy = append(xy, p[0], p[1])
+	}
+	xyVector := float64s(b, xy)
+	b.StartObject(8)
+	b.PrependUOffsetTSlot(geometryXY, xyVector, 0)
+	b.PrependUint8Slot(geometryType, fgbLineString, 0)
+	geometry := b.EndObject()
+	propertyVector := b.CreateByteVector(properties)
+	b.StartObject(3)
+	b.PrependUOffsetTSlot(featureGeometry, geometry, 0)
+	b.PrependUOffsetTSlot(featureProperties, propertyVector, 0)
+	b.FinishSizePrefixed(b.EndObject())
+	return b.FinishedBytes()
+}
+
+// float64s writes a vector of doubles, which the builder has no helper for.
+func float64s(b *flatbuffers.Builder, values []float64) flatbuffers.UOffsetT {
+	b.StartVector(8, len(values), 8)
+	for i := len(values) - 1; i >= 0; i-- {
+		b.PrependFloat64(values[i])
+	}
+	return b.EndVector(len(values))
+}
+
+// hilbertOrder sorts the features by the Hilbert value of their bbox
+// centers on a 65536 x 65536 grid over the extent.
+func hilbertOrder(boxes [][4]float64, extent [4]float64) []int {
+	width, height := extent[2]-extent[0], extent[3]-extent[1]
+	values := make([]uint32, len(boxes))
+	order := make([]int, len(boxes))
+	for i, box := range boxes {
+		var x, y uint32
+		if width > 0 {
+			x = uint32(0xffff * ((box[0]+box[2])/2 - extent[0]) / width)
+		}
+		if height > 0 {
+			y = uint32(0xffff * ((box[1]+box[3])/2 - extent[1]) / height)
+		}
+		values[i] = hilbert(x, y)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return values[order[i]] < values[order[j]] })
+	return order
+}
+
+func hilbert(x uint32, y uint32) uint32 {
+	var d uint32
+	for s := uint32(1 << 15); s > 0; s /= 2 {
+		var rx, ry uint32
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = 0xffff-x, 0xffff-y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// packedRTree builds the static R-tree FlatGeobuf stores between the header
+// and the features: every level packed one after another with the root
+// first and the leaves, in feature order, last. Leaves point at the byte
+// offset of their feature, inner nodes at the index of their first child.
+func packedRTree(boxes [][4]float64, offsets []uint64, order []int) []byte {
+	var levelNodes []int
+	n, total := len(boxes), len(boxes)
+	levelNodes = append(levelNodes, n)
+	for {
+		n = (n + nodeSize - 1) / nodeSize
+		total += n
+		levelNodes = append(levelNodes, n)
+		if n == 1 {
+			break
+		}
+	}
+	// levelStart[0] is the leaves, at the end of the tree
+	levelStart := make([]int, len(levelNodes))
+	n = total
+	for i, size := range levelNodes {
+		levelStart[i] = n - size
+		n -= size
+	}
+
+	type nodeItem struct {
+		box    [4]float64
+		offset uint64
+	}
+	items := make([]nodeItem, total)
+	for i, feature := range order {
+		items[levelStart[0]+i] = nodeItem{boxes[feature], offsets[feature]}
+	}
+	for level := 0; level < len(levelNodes)-1; level++ {
+		pos, end := levelStart[level], levelStart[level]+levelNodes[level]
+		parent := levelStart[level+1]
+		for pos < end {
+			node := nodeItem{bounds(nil), uint64(pos)}
+			for j := 0; j < nodeSize && pos < end; j++ {
+				extend(&node.box, items[pos].box)
+				pos++
+			}
+			items[parent] = node
+			parent++
+		}
+	}
+
+	var b bytes.Buffer
+	for _, item := range items {
+		binary.Write(&b, binary.LittleEndian, item.box)
+		binary.Write(&b, binary.LittleEndian, item.offset)
+	}
+	return b.Bytes()
+}
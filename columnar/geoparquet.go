@@ -0,0 +1,84 @@
+package columnar
+
+import (
+	"encoding/json"
+	"github.com/parquet-go/parquet-go"
+	"os"
+)
+
+var parquetNodes = map[string]parquet.Node{
+	Bool:   parquet.Leaf(parquet.BooleanType),
+	Double: parquet.Leaf(parquet.DoubleType),
+	String: parquet.String(),
+}
+
+// WriteGeoParquet saves the features as a GeoParquet 1.0 file: a required
+// WKB geometry column and one optional column per attribute, in a single
+// row group. Parquet orders the columns of a group by name.
+func WriteGeoParquet(file string, columns []Column, features []Feature) error {
+	group := parquet.Group{"geometry": parquet.Required(parquet.Leaf(parquet.ByteArrayType))}
+	for _, column := range columns {
+		group[column.Name] = parquet.Optional(parquetNodes[column.Type])
+	}
+	schema := parquet.NewSchema("schema", group)
+
+	geo, err := json.Marshal(map[string]interface{}{
+		"version":        "1.0.0",
+		"primary_column": "geometry",
+		"columns": map[string]interface{}{
+			"geometry": map[string]interface{}{
+				"encoding":       "WKB",
+				"geometry_types": []string{"LineString"},
+				"bbox":           totalBounds(features),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	w := parquet.NewWriter(f, schema, parquet.KeyValueMetadata("geo", string(geo)), parquet.CreatedBy("trail", "", ""))
+	geometry, _ := schema.Lookup("geometry")
+	leaves := make([]parquet.LeafColumn, len(columns))
+	for i, column := range columns {
+		leaves[i], _ = schema.Lookup(column.Name)
+	}
+	for _, feature := range features {
+		row := make(parquet.Row, len(columns)+1)
+		row[geometry.ColumnIndex] = parquet.ByteArrayValue(wkb(feature.Coordinates)).Level(0, 0, geometry.ColumnIndex)
+		for i, leaf := range leaves {
+			var value parquet.Value
+			if i < len(feature.Values) && feature.Values[i] != nil {
+				value = parquetValue(feature.Values[i]).Level(0, 1, leaf.ColumnIndex)
+			} else {
+				value = parquet.NullValue().Level(0, 0, leaf.ColumnIndex)
+			}
+			row[leaf.ColumnIndex] = value
+		}
+		if _, err := w.WriteRows([]parquet.Row{row}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func parquetValue(v interface{}) parquet.Value {
+	switch v := v.(type) {
+	case string:
+		return parquet.ByteArrayValue([]byte(v))
+	case float64:
+		return parquet.DoubleValue(v)
+	case bool:
+		return parquet.BooleanValue(v)
+	}
+	return parquet.NullValue()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/mingram/trail/kml"
+	"github.com/mingram/trail/osm"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Condition is a reported state of a trail, from the -conditions file.
+type Condition struct {
+	Status  string
+	Note    string
+	Updated string
+}
+
+// conditionStyle is how trails with a status are drawn instead of in their
+// activity colour. Dash is a stroke-dasharray; KML has no dashed lines so
+// there the style is only a colour and width.
+type conditionStyle struct {
+	Color string
+	// KmlColor is Color as aabbggrr
+	KmlColor string
+	Dash     string
+}
+
+var conditionStyles = map[string]conditionStyle{
+	"closed":  {Color: "#FF0000", KmlColor: "FF0000FF", Dash: "8 6"},
+	"muddy":   {Color: "#8B4513", KmlColor: "FF13458B", Dash: "2 6"},
+	"caution": {Color: "#FF8C00", KmlColor: "FF008CFF", Dash: "2 6"},
+}
+
+// loadConditions reads a CSV with a header row. The trail column holds a
+// trail name, an OSM way id or a trail id; status is required and note and
+// updated, the date of the report, are optional.
+func loadConditions(file string) (map[string]Condition, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"trail", "status"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%s: no %s column", file, name)
+		}
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	conditions := make(map[string]Condition)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		trail := field(record, "trail")
+		if trail == "" {
+			continue
+		}
+		conditions[trail] = Condition{
+			Status:  strings.ToLower(field(record, "status")),
+			Note:    field(record, "note"),
+			Updated: field(record, "updated"),
+		}
+	}
+	return conditions, nil
+}
+
+// condition finds the report for a trail by its trail id, then its way id
+// and last its name, so a single segment can be closed while the rest of
+// the trail is not.
+func (opts exportOptions) condition(node []openStreetMap.Node) (Condition, bool) {
+	if len(opts.Conditions) == 0 {
+		return Condition{}, false
+	}
+	for _, key := range []string{opts.trailId(node), node[0].Wayid, node[0].Name} {
+		if condition, ok := opts.Conditions[key]; ok && key != "" {
+			return condition, true
+		}
+	}
+	return Condition{}, false
+}
+
+// trailStyle is the colour a trail is drawn in and the dash pattern, if
+// any, taking its condition into account.
+func (opts exportOptions) trailStyle(node []openStreetMap.Node) (string, string) {
+	color, _ := GetColor(node[0])
+	if condition, ok := opts.condition(node); ok {
+		if style, ok := conditionStyles[condition.Status]; ok {
+			return style.Color, style.Dash
+		}
+	}
+	return color, ""
+}
+
+// addConditionStyles adds a KML style for each status, named after it.
+func addConditionStyles(k *kml.Kml) {
+	var statuses []string
+	for status := range conditionStyles {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		k.AddStyle(status, conditionStyles[status].KmlColor, 6)
+	}
+}
+
+// unmatchedConditions logs the reports that name no trail, most likely a
+// typo or a way that has since been deleted or renamed.
+func (opts exportOptions) unmatchedConditions(nodes [][]openStreetMap.Node) {
+	used := make(map[string]bool)
+	for _, node := range nodes {
+		used[opts.trailId(node)] = true
+		used[node[0].Wayid] = true
+		used[node[0].Name] = true
+	}
+	var keys []string
+	for key := range opts.Conditions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	matched := 0
+	for _, key := range keys {
+		if used[key] {
+			matched++
+		} else {
+			log.Print("No trail for condition " + key)
+		}
+	}
+	log.Print("Number of trail conditions: " + fmt.Sprintf("%v", matched))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/mingram/trail/gpkg"
+	"github.com/mingram/trail/osm"
+	"sort"
+	"strings"
+)
+
+// poiTags are the tags that make a node worth showing next to the trails.
+// An empty value matches any value.
+var poiTags = [][2]string{
+	{"amenity", "parking"},
+	{"amenity", "toilets"},
+	{"amenity", "drinking_water"},
+	{"amenity", "shelter"},
+	{"amenity", "bicycle_repair_station"},
+	{"highway", "trailhead"},
+	{"tourism", "viewpoint"},
+	{"tourism", "information"},
+	{"tourism", "picnic_site"},
+	{"tourism", "camp_site"},
+	{"leisure", "picnic_table"},
+	{"natural", "peak"},
+	{"natural", "spring"},
+	{"waterway", "waterfall"},
+}
+
+// findPois returns the tagged nodes matching poiTags, along with the tag
+// that matched.
+func findPois(osm openStreetMap.Osm) ([]openStreetMap.Node, []string) {
+	var pois []openStreetMap.Node
+	var kinds []string
+	for _, node := range osm.Nodes {
+		if len(node.Tags) == 0 {
+			continue
+		}
+		types := openStreetMap.TagMap(node.Tags)
+		for _, tag := range poiTags {
+			if types[tag[0]] == tag[1] || tag[1] == "" && types[tag[0]] != "" {
+				pois = append(pois, node)
+				kinds = append(kinds, tag[0]+"="+types[tag[0]])
+				break
+			}
+		}
+	}
+	return pois, kinds
+}
+
+func tagString(tags []openStreetMap.Tag) string {
+	var pairs []string
+	for _, tag := range tags {
+		pairs = append(pairs, tag.Key+"="+tag.Value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+// writeGeoPackage saves the trails, with their activity attributes, and the
+// points of interest around them into one GeoPackage for QGIS and the
+// backend.
+func (opts exportOptions) writeGeoPackage(file string, nodes [][]openStreetMap.Node, osm openStreetMap.Osm) error {
+	trails := gpkg.Layer{
+		Name:         "trails",
+		Description:  "Trails by OSM way",
+		GeometryType: gpkg.LineString,
+		Columns: []gpkg.Column{
+			{Name: "way_id", Type: "INTEGER"},
+			{Name: "name", Type: "TEXT"},
+			{Name: "name_source", Type: "TEXT"},
+			{Name: "park", Type: "TEXT"},
+			{Name: "activity", Type: "TEXT"},
+			{Name: "style", Type: "TEXT"},
+			{Name: "distance_km", Type: "REAL"},
+			{Name: "ski_difficulty", Type: "TEXT"},
+			{Name: "ski_description", Type: "TEXT"},
+			{Name: "ski_type", Type: "TEXT"},
+			{Name: "bike_difficulty", Type: "TEXT"},
+			{Name: "bike_description", Type: "TEXT"},
+			{Name: "bike_surface", Type: "TEXT"},
+			{Name: "foot_difficulty", Type: "TEXT"},
+			{Name: "foot_type", Type: "TEXT"},
+			{Name: "foot_surface", Type: "TEXT"},
+		},
+	}
+	for _, node := range nodes {
+		color, tipo := GetColor(node[0])
+		var coordinates [][]float64
+		for _, nd := range node {
+			coordinates = append(coordinates, []float64{nd.Lon, nd.Lat})
+		}
+		n := node[0]
+		trails.Rows = append(trails.Rows, gpkg.Row{
+			Geometry: coordinates,
+			Values: []interface{}{
+				n.Wayid, n.Name, n.NameSource, n.Park, tipo, color, opts.trailLength(node),
+				n.Ski.Diff, n.Ski.Description, n.Ski.Tipo,
+				n.Mtnbike.Diff, n.Mtnbike.Description, n.Mtnbike.Surface,
+				n.Foot.Diff, n.Foot.Tipo, n.Foot.Surface,
+			},
+		})
+	}
+
+	pois := gpkg.Layer{
+		Name:         "pois",
+		Description:  "Trailheads, parking and other points of interest",
+		GeometryType: gpkg.Point,
+		Columns: []gpkg.Column{
+			{Name: "node_id", Type: "INTEGER"},
+			{Name: "name", Type: "TEXT"},
+			{Name: "kind", Type: "TEXT"},
+			{Name: "tags", Type: "TEXT"},
+		},
+	}
+	points, kinds := findPois(osm)
+	for i, node := range points {
+		pois.Rows = append(pois.Rows, gpkg.Row{
+			Geometry: [][]float64{{node.Lon, node.Lat}},
+			Values:   []interface{}{node.Id, openStreetMap.TagMap(node.Tags)["name"], kinds[i], tagString(node.Tags)},
+		})
+	}
+	return gpkg.Write(file, []gpkg.Layer{trails, pois})
+}
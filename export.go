@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/kml"
+	"github.com/mingram/trail/osm"
+	"github.com/mingram/trail/simplify"
+	"github.com/mingram/trail/units"
+	htmltemplate "html/template"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"text/template"
+)
+
+func addStyles(k *kml.Kml) {
+	k.AddStyle("00FFFF", "FF00FFFF", 4)
+	k.AddStyle("FFD700", "FFFFD700", 4)
+	k.AddStyle("3333ff", "FF3333ff", 4)
+	k.AddStyle("d699ff", "FFd699ff", 4)
+	k.AddStyle("00FFFF", "FF00FFFF", 4)
+	k.AddStyle("b3b3ff", "FFb3b3ff", 4)
+	k.AddStyle("FF4DFF", "FFFF4DFF", 4)
+	k.AddStyle("ff99cc", "FFff99cc", 4)
+	k.AddStyle("ffff66", "FFffff66", 4)
+}
+
+// exportOptions holds the settings shared by every trail that gets written.
+type exportOptions struct {
+	Activity string
+	// FileTypes are the registered exporters to write, in -type order
+	FileTypes []string
+	Layout    string
+	TileZoom  int
+	MVT       string
+	HTML      string
+	// Changed limits the update command to rewriting documents that hold
+	// one of these way ids, or held one last time
+	Changed        map[string]bool
+	MinZoom        int
+	MaxZoom        int
+	Simplify       float64
+	SimplifyMethod string
+	// Junctions are the node ids shared by more than one trail
+	Junctions map[string]bool
+	// Pieces are the way ids clipping cut into more than one trail
+	Pieces map[string]bool
+	// Units writes lengths and climbs, and Description is the template
+	// placemark descriptions are made from
+	Units       units.Units
+	Description *template.Template
+	// Balloon, when set, replaces Description in KML with HTML
+	Balloon *htmltemplate.Template
+	// Conditions are the reported trail conditions, by trail id, way id
+	// or name
+	Conditions map[string]Condition
+	// Metric measures every length, picked with -geodesic
+	Metric geo.Metric
+}
+
+func junctionNodes(nodes [][]openStreetMap.Node) map[string]bool {
+	seen := make(map[string]int)
+	junctions := make(map[string]bool)
+	for i, node := range nodes {
+		for _, nd := range node {
+			if other, ok := seen[nd.Id]; ok && other != i {
+				junctions[nd.Id] = true
+			}
+			seen[nd.Id] = i
+		}
+	}
+	return junctions
+}
+
+// simplify thins out the coordinates of a trail, never dropping a node
+// another trail connects to.
+func (opts exportOptions) simplify(coordinates [][]float64, node []openStreetMap.Node) [][]float64 {
+	if opts.Simplify <= 0 {
+		return coordinates
+	}
+	fixed := make([]bool, len(node))
+	for i, nd := range node {
+		fixed[i] = opts.Junctions[nd.Id]
+	}
+	return simplify.Line(coordinates, opts.Simplify, opts.SimplifyMethod, fixed)
+}
+
+func (opts exportOptions) trailFeature(node []openStreetMap.Node) Feature {
+	color, dash := opts.trailStyle(node)
+	var coordinates [][]float64
+	for _, nd := range node {
+		coordinates = append(coordinates, []float64{nd.Lon, nd.Lat})
+	}
+	coordinates = opts.simplify(coordinates, node)
+	for _, c := range coordinates {
+		c[0], c[1] = roundCoord(c[0]), roundCoord(c[1])
+	}
+	feature := Feature{}
+	feature.Tipo = "Feature"
+	feature.Id = opts.trailId(node)
+	feature.Properties = Properties{Name: node[0].Name, NameSource: node[0].NameSource, SyntheticName: syntheticName(node[0].NameSource), Park: node[0].Park, Stroke: color, Fill: "#FFF", FillOpacity: .5, StrokeOpacity: 1.0, StrokeWidth: 2}
+	feature.Properties.Segment = node[0].Segment
+	feature.Properties.StrokeDasharray = dash
+	if condition, ok := opts.condition(node); ok {
+		feature.Properties.Status = condition.Status
+		feature.Properties.StatusNote = condition.Note
+		feature.Properties.StatusUpdated = condition.Updated
+	}
+	feature.Properties.Length = opts.Units.Distance(opts.trailLength(node))
+	if climb, ok := trailClimb(node); ok {
+		feature.Properties.Climb = opts.Units.Height(climb)
+	}
+	feature.Geometry = Geometry{"LineString", coordinates}
+	return feature
+}
+
+// roundCoord cuts a coordinate to the 7 decimal places OSM stores, so
+// floating point noise from clipping never shows up as a diff.
+func roundCoord(v float64) float64 {
+	return math.Round(v*1e7) / 1e7
+}
+
+// trailLength is the length of the trail in km.
+func (opts exportOptions) trailLength(node []openStreetMap.Node) float64 {
+	return opts.Metric.Length(nodePoints(node))
+}
+
+func nodePoints(node []openStreetMap.Node) []geo.Point {
+	points := make([]geo.Point, len(node))
+	for i, nd := range node {
+		points[i] = geo.Point{Lon: nd.Lon, Lat: nd.Lat}
+	}
+	return points
+}
+
+func (opts exportOptions) trailPlacemark(node []openStreetMap.Node) (string, string, string, [][]float64) {
+	var kmlCoordinates [][]float64
+	color, _ := GetColor(node[0])
+	if condition, ok := opts.condition(node); ok {
+		if _, styled := conditionStyles[condition.Status]; styled {
+			color = "#" + condition.Status
+		}
+	}
+	for _, nd := range node {
+		kmlCoordinates = append(kmlCoordinates, []float64{nd.Lon, nd.Lat, 0.0})
+	}
+	kmlCoordinates = opts.simplify(kmlCoordinates, node)
+	name := strings.Replace(node[0].Name, "/", "-", -1)
+	return name, color, opts.describe(node), kmlCoordinates
+}
+
+// export writes every trail in each format and the layout picked on the
+// command line, plus the ALL_TRAILS document and the index of files written.
+func (opts exportOptions) export(nodes [][]openStreetMap.Node) {
+	if opts.Changed != nil {
+		opts.Changed = opts.derivedChanges(nodes)
+		log.Print("Number of ways to write again: " + fmt.Sprintf("%v", len(opts.Changed)))
+	}
+	groups, keys := groupTrails(opts.Layout, nodes, opts.TileZoom)
+	names := fileNames(keys)
+	for _, fileType := range opts.FileTypes {
+		opts.exportFormat(fileType, exporters[fileType], nodes, groups, keys, names)
+	}
+
+	if opts.MVT != "" {
+		if err := opts.writeTiles(opts.MVT, nodes, opts.MinZoom, opts.MaxZoom); err != nil {
+			log.Print(err)
+		}
+	}
+	if opts.HTML != "" {
+		if err := opts.writeHTML(opts.HTML, nodes); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+func (opts exportOptions) exportFormat(fileType string, exporter Exporter, nodes [][]openStreetMap.Node, groups map[string][]int, keys []string, names map[string]string) {
+	dir, ext := exporter.Dir(), exporter.Ext()
+	os.MkdirAll(dir+"/trails", os.ModePerm)
+	manifest := Manifest{Layout: opts.Layout, Type: fileType}
+	stale := make(map[string]bool)
+	if opts.Changed != nil {
+		manifest, stale = opts.staleFiles(fileType, dir, ext)
+	}
+
+	all := exporter.NewDocument(opts.Activity+" Trails", opts)
+	written := 0
+	for _, key := range keys {
+		var group [][]openStreetMap.Node
+		changed := false
+		for _, i := range groups[key] {
+			group = append(group, nodes[i])
+			changed = changed || opts.Changed[nodes[i][0].Wayid]
+		}
+		file := dir + "/trails/" + names[key] + ext
+		title := key
+		if opts.Layout == "way" {
+			title = group[0][0].Name
+		}
+		doc := exporter.NewDocument(title, opts)
+		for _, node := range group {
+			doc.Add(node)
+			all.Add(node)
+		}
+		// ALL_TRAILS still needs every trail, only the file is skipped
+		if opts.Changed != nil && !changed && !stale[file] {
+			continue
+		}
+		if err := saveDocument(doc, file); err != nil {
+			log.Print(err)
+			continue
+		}
+		manifest.Add(file, key, group)
+		written++
+	}
+	log.Print("Number of " + fileType + " files written: " + fmt.Sprintf("%v", written))
+
+	allFile := dir + "/ALL_TRAILS" + ext
+	if err := saveDocument(all, allFile); err != nil {
+		log.Print(err)
+	}
+	manifest.Add(allFile, opts.Activity+" Trails", nodes)
+	if err := manifest.SaveFile(dir + "/index.json"); err != nil {
+		log.Print(err)
+	}
+}
+
+// derivedChanges adds to the changed ways those whose trails came out
+// named, in a park or split differently from the last export of any type.
+// A park boundary moving, the trail an unnamed connector is named after
+// being renamed or a new junction all do that to ways the diff never
+// touched. ALL_TRAILS holds every trail, so its index entry is the before.
+func (opts exportOptions) derivedChanges(nodes [][]openStreetMap.Node) map[string]bool {
+	changed := make(map[string]bool, len(opts.Changed))
+	for way := range opts.Changed {
+		changed[way] = true
+	}
+	after := make(map[string][]TrailState)
+	for _, node := range nodes {
+		after[node[0].Wayid] = append(after[node[0].Wayid], trailState(node))
+	}
+	for _, fileType := range opts.FileTypes {
+		exporter := exporters[fileType]
+		old, err := LoadManifest(exporter.Dir() + "/index.json")
+		if err != nil {
+			// staleFiles says so
+			continue
+		}
+		before := make(map[string][]TrailState)
+		for _, entry := range old.Files {
+			if entry.File != exporter.Dir()+"/ALL_TRAILS"+exporter.Ext() {
+				continue
+			}
+			for _, state := range entry.State {
+				before[state.Way] = append(before[state.Way], state)
+			}
+		}
+		for way, states := range before {
+			if !sameStates(states, after[way]) {
+				changed[way] = true
+			}
+		}
+		for way := range after {
+			if _, ok := before[way]; !ok {
+				changed[way] = true
+			}
+		}
+	}
+	return changed
+}
+
+func sameStates(a []TrailState, b []TrailState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// staleFiles loads the index from the last run, deletes the files that held
+// a changed way and returns the index without them.
+func (opts exportOptions) staleFiles(fileType string, dir string, ext string) (Manifest, map[string]bool) {
+	manifest := Manifest{Layout: opts.Layout, Type: fileType}
+	stale := make(map[string]bool)
+	old, err := LoadManifest(dir + "/index.json")
+	if err != nil {
+		log.Print(err)
+		return manifest, stale
+	}
+	for _, entry := range old.Files {
+		if entry.File == dir+"/ALL_TRAILS"+ext {
+			continue
+		}
+		changed := false
+		for _, way := range entry.Ways {
+			changed = changed || opts.Changed[way]
+		}
+		if changed {
+			stale[entry.File] = true
+			os.Remove(entry.File)
+		} else {
+			manifest.Files = append(manifest.Files, entry)
+		}
+	}
+	return manifest, stale
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mingram/trail/gpx"
+	"github.com/mingram/trail/kml"
+	"github.com/mingram/trail/osm"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Exporter is one output format. Formats register themselves by name so
+// -type can ask for any mix of them from a single pass over the extract.
+type Exporter interface {
+	// Dir is where the format's documents go and Ext their file extension
+	Dir() string
+	Ext() string
+	ContentType() string
+	NewDocument(title string, opts exportOptions) Document
+}
+
+// Document collects trails and writes them out once it is complete.
+type Document interface {
+	Add(node []openStreetMap.Node)
+	Encode(w io.Writer) error
+}
+
+// Streamer is an Exporter that can write trails out as it goes, without
+// collecting a whole document first. The server uses it when it can.
+type Streamer interface {
+	Stream(w io.Writer, title string, opts exportOptions, trails [][]openStreetMap.Node) error
+}
+
+var exporters = make(map[string]Exporter)
+
+func registerExporter(name string, exporter Exporter) {
+	exporters[name] = exporter
+}
+
+func exporterNames() []string {
+	var names []string
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseTypes splits a comma separated -type into formats, dropping
+// repeats.
+func parseTypes(s string) ([]string, error) {
+	var types []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := exporters[name]; !ok {
+			return nil, fmt.Errorf("unknown -type %q, want one or more of %s", name, strings.Join(exporterNames(), ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			types = append(types, name)
+		}
+	}
+	return types, nil
+}
+
+func saveDocument(doc Document, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := doc.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type kmlExporter struct{}
+
+func (kmlExporter) Dir() string         { return "kmls" }
+func (kmlExporter) Ext() string         { return ".kml" }
+func (kmlExporter) ContentType() string { return "application/vnd.google-earth.kml+xml" }
+
+func (kmlExporter) NewDocument(title string, opts exportOptions) Document {
+	doc := &kmlDocument{KML: kml.NewKml(title, "Trails"), opts: opts}
+	addStyles(&doc.KML)
+	if len(opts.Conditions) > 0 {
+		addConditionStyles(&doc.KML)
+	}
+	if opts.Balloon != nil {
+		doc.KML.SetBalloon(balloonText)
+	}
+	return doc
+}
+
+type kmlDocument struct {
+	KML  kml.Kml
+	opts exportOptions
+}
+
+func (doc *kmlDocument) Add(node []openStreetMap.Node) {
+	name, color, description, kmlCoordinates := doc.opts.trailPlacemark(node)
+	if doc.opts.Balloon != nil {
+		doc.KML.AddHTMLPlacemark(name, color, doc.opts.describeHTML(node), kmlCoordinates, node)
+	} else {
+		doc.KML.AddPlacemark(name, color, description, kmlCoordinates, node, "true")
+	}
+	doc.KML.SetId(doc.opts.trailId(node), len(doc.KML.Placemarks)-1)
+}
+
+func (doc *kmlDocument) Encode(w io.Writer) error {
+	return doc.KML.Encode(w)
+}
+
+// Stream adds each trail to an otherwise empty document and writes its
+// placemark straight away.
+func (exporter kmlExporter) Stream(w io.Writer, title string, opts exportOptions, trails [][]openStreetMap.Node) error {
+	doc := exporter.NewDocument(title, opts).(*kmlDocument)
+	enc := kml.NewEncoder(w)
+	if err := enc.Begin(&doc.KML); err != nil {
+		return err
+	}
+	for _, node := range trails {
+		doc.Add(node)
+		if err := enc.Placemark(doc.KML.Placemarks[0]); err != nil {
+			return err
+		}
+		doc.KML.Placemarks = doc.KML.Placemarks[:0]
+	}
+	return enc.End()
+}
+
+type geojsonExporter struct{}
+
+func (geojsonExporter) Dir() string         { return "geojson" }
+func (geojsonExporter) Ext() string         { return ".json" }
+func (geojsonExporter) ContentType() string { return "application/geo+json" }
+
+func (geojsonExporter) NewDocument(title string, opts exportOptions) Document {
+	return &geojsonDocument{GeoJson: GeoJson{Tipo: "FeatureCollection"}, opts: opts}
+}
+
+type geojsonDocument struct {
+	GeoJson GeoJson
+	opts    exportOptions
+}
+
+func (doc *geojsonDocument) Add(node []openStreetMap.Node) {
+	doc.GeoJson.Features = append(doc.GeoJson.Features, doc.opts.trailFeature(node))
+}
+
+func (doc *geojsonDocument) Encode(w io.Writer) error {
+	json, err := json.Marshal(doc.GeoJson)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(json)
+	return err
+}
+
+// Stream writes a FeatureCollection a feature at a time.
+func (geojsonExporter) Stream(w io.Writer, title string, opts exportOptions, trails [][]openStreetMap.Node) error {
+	if _, err := io.WriteString(w, `{"type":"FeatureCollection","features":[`); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for i, node := range trails {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(opts.trailFeature(node)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]}")
+	return err
+}
+
+type gpxExporter struct{}
+
+func (gpxExporter) Dir() string         { return "gpxs" }
+func (gpxExporter) Ext() string         { return ".gpx" }
+func (gpxExporter) ContentType() string { return "application/gpx+xml" }
+
+func (gpxExporter) NewDocument(title string, opts exportOptions) Document {
+	return &gpxDocument{GPX: gpx.NewGpx(title), opts: opts}
+}
+
+type gpxDocument struct {
+	GPX  gpx.Gpx
+	opts exportOptions
+}
+
+func (doc *gpxDocument) Add(node []openStreetMap.Node) {
+	name, _, description, coords := doc.opts.trailPlacemark(node)
+	doc.GPX.AddTrack(name, description, coords)
+}
+
+func (doc *gpxDocument) Encode(w io.Writer) error {
+	return doc.GPX.Encode(w)
+}
+
+// Stream writes each trail's track as soon as it is made.
+func (gpxExporter) Stream(w io.Writer, title string, opts exportOptions, trails [][]openStreetMap.Node) error {
+	GPX := gpx.NewGpx(title)
+	enc := gpx.NewEncoder(w)
+	if err := enc.Begin(&GPX); err != nil {
+		return err
+	}
+	for _, node := range trails {
+		name, _, description, coords := opts.trailPlacemark(node)
+		GPX.AddTrack(name, description, coords)
+		if err := enc.Track(GPX.Tracks[0]); err != nil {
+			return err
+		}
+		GPX.Tracks = GPX.Tracks[:0]
+	}
+	return enc.End()
+}
+
+func init() {
+	registerExporter("kml", kmlExporter{})
+	registerExporter("geojson", geojsonExporter{})
+	registerExporter("gpx", gpxExporter{})
+}
@@ -0,0 +1,179 @@
+package geo
+
+import (
+	"math"
+)
+
+const (
+	// EarthRadiusKm is the mean radius the haversine distance uses
+	EarthRadiusKm = 6371.0
+
+	// WGS84 ellipsoid
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// Point is a WGS84 position in degrees. Fields are named, rather than lat
+// and lon being passed in some order, so they cannot be swapped.
+type Point struct {
+	Lon float64
+	Lat float64
+}
+
+// FromCoords turns [lon, lat, ...] coordinates into points.
+func FromCoords(coords [][]float64) []Point {
+	points := make([]Point, len(coords))
+	for i, c := range coords {
+		points[i] = Point{Lon: c[0], Lat: c[1]}
+	}
+	return points
+}
+
+// Metric measures the distance between two points in km. Lines are
+// measured with whichever metric Length and Along are called on.
+type Metric func(a Point, b Point) float64
+
+// Metrics are the metrics that can be picked by name.
+var Metrics = map[string]Metric{
+	"haversine": Haversine,
+	"vincenty":  Vincenty,
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Haversine is the great circle distance on a sphere of EarthRadiusKm.
+func Haversine(a Point, b Point) float64 {
+	return EarthRadiusKm * angle(a, b)
+}
+
+// angle is the central angle between two points, in radians.
+func angle(a Point, b Point) float64 {
+	dLat := radians(b.Lat - a.Lat)
+	dLon := radians(b.Lon - a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(a.Lat))*math.Cos(radians(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
+
+// Vincenty is the distance on the WGS84 ellipsoid, good to well under a
+// millimetre. Vincenty's iteration does not converge for points that are
+// nearly antipodal, the case Karney's method was made for; those fall back
+// to Haversine, which no trail will ever need.
+func Vincenty(a Point, b Point) float64 {
+	L := radians(b.Lon - a.Lon)
+	U1 := math.Atan((1 - wgs84F) * math.Tan(radians(a.Lat)))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(radians(b.Lat)))
+	sinU1, cosU1 := math.Sin(U1), math.Cos(U1)
+	sinU2, cosU2 := math.Sin(U2), math.Cos(U2)
+
+	lambda := L
+	for i := 0; i < 200; i++ {
+		sinLambda, cosLambda := math.Sin(lambda), math.Cos(lambda)
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0
+		if cos2Alpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+		C := wgs84F / 16 * cos2Alpha * (4 + wgs84F*(4-3*cos2Alpha))
+		previous := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-previous) < 1e-12 {
+			u2 := cos2Alpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+			A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+			B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+			deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+			return wgs84B * A * (sigma - deltaSigma) / 1000
+		}
+	}
+	return Haversine(a, b)
+}
+
+// Bearing is the initial great circle bearing from a to b in degrees
+// clockwise from north, 0 to 360.
+func Bearing(a Point, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLon := radians(b.Lon - a.Lon)
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// FinalBearing is the bearing on arrival at b.
+func FinalBearing(a Point, b Point) float64 {
+	return math.Mod(Bearing(b, a)+180, 360)
+}
+
+// Interpolate returns the point a fraction f of the way from a to b along
+// the great circle.
+func Interpolate(a Point, b Point, f float64) Point {
+	delta := angle(a, b)
+	if delta == 0 {
+		return a
+	}
+	lat1, lon1 := radians(a.Lat), radians(a.Lon)
+	lat2, lon2 := radians(b.Lat), radians(b.Lon)
+	wa := math.Sin((1-f)*delta) / math.Sin(delta)
+	wb := math.Sin(f*delta) / math.Sin(delta)
+	x := wa*math.Cos(lat1)*math.Cos(lon1) + wb*math.Cos(lat2)*math.Cos(lon2)
+	y := wa*math.Cos(lat1)*math.Sin(lon1) + wb*math.Cos(lat2)*math.Sin(lon2)
+	z := wa*math.Sin(lat1) + wb*math.Sin(lat2)
+	return Point{Lon: degrees(math.Atan2(y, x)), Lat: degrees(math.Atan2(z, math.Hypot(x, y)))}
+}
+
+// Length is the length of a line in km.
+func (distance Metric) Length(line []Point) float64 {
+	km := 0.0
+	for i := 1; i < len(line); i++ {
+		km += distance(line[i-1], line[i])
+	}
+	return km
+}
+
+// Along returns the point km along the line, clamped to its ends.
+func (distance Metric) Along(line []Point, km float64) Point {
+	if len(line) == 0 {
+		return Point{}
+	}
+	for i := 1; i < len(line); i++ {
+		d := distance(line[i-1], line[i])
+		if km <= d {
+			if d == 0 {
+				return line[i-1]
+			}
+			return Interpolate(line[i-1], line[i], math.Max(km, 0)/d)
+		}
+		km -= d
+	}
+	return line[len(line)-1]
+}
+
+// Flat projects p to metres east and north of origin on a plane, which is
+// accurate enough across a single trail and much cheaper than the
+// spherical formulas.
+func Flat(origin Point, p Point) (float64, float64) {
+	x := radians(p.Lon-origin.Lon) * math.Cos(radians(origin.Lat)) * EarthRadiusKm * 1000
+	y := radians(p.Lat-origin.Lat) * EarthRadiusKm * 1000
+	return x, y
+}
+
+// Unflat is the inverse of Flat.
+func Unflat(origin Point, x float64, y float64) Point {
+	lat := origin.Lat + degrees(y/(EarthRadiusKm*1000))
+	lon := origin.Lon + degrees(x/(EarthRadiusKm*1000*math.Cos(radians(origin.Lat))))
+	return Point{Lon: lon, Lat: lat}
+}
@@ -0,0 +1,151 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+// dms turns degrees, minutes and seconds into degrees, negative for south
+// and west when d is.
+func dms(d float64, m float64, s float64) float64 {
+	if d < 0 {
+		return d - m/60 - s/3600
+	}
+	return d + m/60 + s/3600
+}
+
+var (
+	// Geoscience Australia's worked example for Vincenty's formulae
+	flindersPeak = Point{Lon: dms(144, 25, 29.52440), Lat: dms(-37, 57, 3.72030)}
+	buninyong    = Point{Lon: dms(143, 55, 35.38390), Lat: dms(-37, 39, 10.15610)}
+
+	// the pair Movable Type Scripts works its spherical examples on
+	landsEnd    = Point{Lon: dms(-5, 42, 53), Lat: dms(50, 3, 59)}
+	johnOGroats = Point{Lon: dms(-3, 4, 12), Lat: dms(58, 38, 38)}
+)
+
+func near(t *testing.T, name string, got float64, want float64, tolerance float64) {
+	t.Helper()
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("%s = %.9f, want %.9f within %g", name, got, want, tolerance)
+	}
+}
+
+func TestVincenty(t *testing.T) {
+	near(t, "Flinders Peak to Buninyong", Vincenty(flindersPeak, buninyong), 54.972271, 1e-6)
+	near(t, "Buninyong to Flinders Peak", Vincenty(buninyong, flindersPeak), 54.972271, 1e-6)
+	// the same trip to a hundredth of a second, as their Vincenty example
+	near(t, "Land's End to John o'Groats", Vincenty(
+		Point{Lon: dms(-5, 42, 53.10), Lat: dms(50, 3, 58.76)},
+		Point{Lon: dms(-3, 4, 12.34), Lat: dms(58, 38, 38.48)},
+	), 969.954, 5e-4)
+	near(t, "same point", Vincenty(landsEnd, landsEnd), 0, 0)
+	// a quarter of the equator is a quarter of its circumference
+	near(t, "along the equator", Vincenty(Point{0, 0}, Point{90, 0}), math.Pi*wgs84A/2/1000, 1e-6)
+
+	// nearly antipodal points do not converge and fall back to Haversine
+	a, b := Point{Lon: 0, Lat: 0}, Point{Lon: 179.7, Lat: 0.5}
+	near(t, "nearly antipodal", Vincenty(a, b), Haversine(a, b), 1e-9)
+}
+
+func TestHaversine(t *testing.T) {
+	near(t, "Land's End to John o'Groats", Haversine(landsEnd, johnOGroats), 968.9, 0.05)
+	near(t, "one degree of latitude", Haversine(Point{0, 0}, Point{0, 1}), EarthRadiusKm*math.Pi/180, 1e-9)
+}
+
+func TestBearing(t *testing.T) {
+	near(t, "initial bearing", Bearing(landsEnd, johnOGroats), dms(9, 7, 11), 1.0/3600)
+	near(t, "final bearing", FinalBearing(landsEnd, johnOGroats), dms(11, 16, 31), 1.0/3600)
+	near(t, "due north", Bearing(Point{0, 0}, Point{0, 1}), 0, 1e-9)
+	near(t, "due east", Bearing(Point{0, 0}, Point{1, 0}), 90, 1e-9)
+	near(t, "due south", Bearing(Point{0, 1}, Point{0, 0}), 180, 1e-9)
+	near(t, "due west", Bearing(Point{1, 0}, Point{0, 0}), 270, 1e-9)
+}
+
+func TestInterpolate(t *testing.T) {
+	mid := Interpolate(landsEnd, johnOGroats, 0.5)
+	near(t, "midpoint lat", mid.Lat, dms(54, 21, 44), 1.0/3600)
+	near(t, "midpoint lon", mid.Lon, dms(-4, 31, 50), 1.0/3600)
+	near(t, "halfway there", Haversine(landsEnd, mid), Haversine(landsEnd, johnOGroats)/2, 1e-9)
+
+	for _, f := range []float64{0, 1} {
+		p := Interpolate(landsEnd, johnOGroats, f)
+		want := landsEnd
+		if f == 1 {
+			want = johnOGroats
+		}
+		near(t, "end lat", p.Lat, want.Lat, 1e-9)
+		near(t, "end lon", p.Lon, want.Lon, 1e-9)
+	}
+	if p := Interpolate(landsEnd, landsEnd, 0.3); p != landsEnd {
+		t.Errorf("Interpolate between a point and itself = %v, want %v", p, landsEnd)
+	}
+}
+
+func TestAlong(t *testing.T) {
+	haversine := Metric(Haversine)
+	line := []Point{{0, 0}, {0, 1}, {1, 1}}
+	first := Haversine(line[0], line[1])
+	total := haversine.Length(line)
+	near(t, "length", total, first+Haversine(line[1], line[2]), 1e-9)
+
+	tests := []struct {
+		km   float64
+		want Point
+	}{
+		{-1, line[0]},
+		{0, line[0]},
+		{first / 2, Point{0, 0.5}},
+		{first, line[1]},
+		{first + Haversine(line[1], line[2])/2, Interpolate(line[1], line[2], 0.5)},
+		{total, line[2]},
+		{total + 1, line[2]},
+	}
+	for _, test := range tests {
+		p := haversine.Along(line, test.km)
+		near(t, "lat along", p.Lat, test.want.Lat, 1e-9)
+		near(t, "lon along", p.Lon, test.want.Lon, 1e-9)
+	}
+	if p := haversine.Along(nil, 1); p != (Point{}) {
+		t.Errorf("Along an empty line = %v, want the zero point", p)
+	}
+}
+
+func TestMetric(t *testing.T) {
+	line := []Point{flindersPeak, buninyong, landsEnd}
+	for name, metric := range Metrics {
+		want := metric(flindersPeak, buninyong) + metric(buninyong, landsEnd)
+		near(t, name+" length", metric.Length(line), want, 1e-9)
+		// the first leg's own length along lands on its end
+		p := metric.Along(line, metric(flindersPeak, buninyong))
+		near(t, name+" along lat", p.Lat, buninyong.Lat, 1e-9)
+		near(t, name+" along lon", p.Lon, buninyong.Lon, 1e-9)
+	}
+	if Metrics["haversine"].Length(line) == Metrics["vincenty"].Length(line) {
+		t.Error("haversine and vincenty measure the same length")
+	}
+}
+
+func TestFlat(t *testing.T) {
+	origin := Point{Lon: -77.45, Lat: 39.52}
+	x, y := Flat(origin, origin)
+	near(t, "origin x", x, 0, 0)
+	near(t, "origin y", y, 0, 0)
+
+	// a kilometre north is a kilometre on the sphere
+	x, y = Flat(origin, Point{Lon: origin.Lon, Lat: origin.Lat + degrees(1/EarthRadiusKm)})
+	near(t, "north x", x, 0, 1e-9)
+	near(t, "north y", y, 1000, 1e-6)
+
+	// across a trail the plane agrees with Haversine to well under a metre
+	p := Point{Lon: -77.43, Lat: 39.53}
+	x, y = Flat(origin, p)
+	near(t, "flat distance", math.Hypot(x, y), Haversine(origin, p)*1000, 0.5)
+
+	for _, p := range []Point{p, {Lon: -77.5, Lat: 39.4}, {Lon: -77.45, Lat: 39.6}} {
+		x, y := Flat(origin, p)
+		back := Unflat(origin, x, y)
+		near(t, "round trip lat", back.Lat, p.Lat, 1e-12)
+		near(t, "round trip lon", back.Lon, p.Lon, 1e-12)
+	}
+}
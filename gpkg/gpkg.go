@@ -0,0 +1,173 @@
+package gpkg
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	LineString = "LINESTRING"
+	Point      = "POINT"
+
+	// every layer is plain WGS84 lon/lat
+	srsId = 4326
+)
+
+type Column struct {
+	Name string
+	// Type is a SQLite column type: TEXT, REAL or INTEGER
+	Type string
+}
+
+// Row is one feature. Geometry is [lon, lat] points, a single point for
+// POINT layers, and Values line up with the layer's Columns.
+type Row struct {
+	Geometry [][]float64
+	Values   []interface{}
+}
+
+type Layer struct {
+	Name         string
+	Description  string
+	GeometryType string
+	Columns      []Column
+	Rows         []Row
+}
+
+// Write creates a new GeoPackage holding the layers, replacing any existing
+// file.
+func Write(file string, layers []Layer) error {
+	os.Remove(file)
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := writeLayers(tx, layers); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeLayers(tx *sql.Tx, layers []Layer) error {
+	statements := []string{
+		"PRAGMA application_id = 1196444487",
+		"PRAGMA user_version = 10200",
+		`CREATE TABLE gpkg_spatial_ref_sys (
+			srs_name TEXT NOT NULL, srs_id INTEGER PRIMARY KEY, organization TEXT NOT NULL,
+			organization_coordsys_id INTEGER NOT NULL, definition TEXT NOT NULL, description TEXT)`,
+		`CREATE TABLE gpkg_contents (
+			table_name TEXT NOT NULL PRIMARY KEY, data_type TEXT NOT NULL, identifier TEXT UNIQUE,
+			description TEXT DEFAULT '', last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			min_x DOUBLE, min_y DOUBLE, max_x DOUBLE, max_y DOUBLE,
+			srs_id INTEGER REFERENCES gpkg_spatial_ref_sys(srs_id))`,
+		`CREATE TABLE gpkg_geometry_columns (
+			table_name TEXT NOT NULL, column_name TEXT NOT NULL, geometry_type_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL, z TINYINT NOT NULL, m TINYINT NOT NULL,
+			CONSTRAINT pk_geom_cols PRIMARY KEY (table_name, column_name))`,
+		`INSERT INTO gpkg_spatial_ref_sys VALUES
+			('Undefined cartesian SRS', -1, 'NONE', -1, 'undefined', 'undefined cartesian coordinate reference system'),
+			('Undefined geographic SRS', 0, 'NONE', 0, 'undefined', 'undefined geographic coordinate reference system'),
+			('WGS 84 geodetic', 4326, 'EPSG', 4326, 'GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AUTHORITY["EPSG","4326"]]', 'longitude/latitude coordinates in decimal degrees on the WGS 84 spheroid')`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	for _, layer := range layers {
+		if err := writeLayer(tx, layer); err != nil {
+			return fmt.Errorf("%s: %v", layer.Name, err)
+		}
+	}
+	return nil
+}
+
+func quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func writeLayer(tx *sql.Tx, layer Layer) error {
+	columns := []string{"fid INTEGER PRIMARY KEY AUTOINCREMENT", "geom " + layer.GeometryType}
+	names := []string{"geom"}
+	params := []string{"?"}
+	for _, column := range layer.Columns {
+		columns = append(columns, quote(column.Name)+" "+column.Type)
+		names = append(names, quote(column.Name))
+		params = append(params, "?")
+	}
+	if _, err := tx.Exec("CREATE TABLE " + quote(layer.Name) + " (" + strings.Join(columns, ", ") + ")"); err != nil {
+		return err
+	}
+	insert, err := tx.Prepare("INSERT INTO " + quote(layer.Name) + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, row := range layer.Rows {
+		geom, envelope := encodeGeometry(layer.GeometryType, row.Geometry)
+		bounds[0], bounds[1] = math.Min(bounds[0], envelope[0]), math.Min(bounds[1], envelope[2])
+		bounds[2], bounds[3] = math.Max(bounds[2], envelope[1]), math.Max(bounds[3], envelope[3])
+		if _, err := insert.Exec(append([]interface{}{geom}, row.Values...)...); err != nil {
+			return err
+		}
+	}
+	if len(layer.Rows) == 0 {
+		bounds = [4]float64{}
+	}
+
+	_, err = tx.Exec(`INSERT INTO gpkg_contents (table_name, data_type, identifier, description, last_change, min_x, min_y, max_x, max_y, srs_id)
+		VALUES (?, 'features', ?, ?, ?, ?, ?, ?, ?, ?)`,
+		layer.Name, layer.Name, layer.Description, time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		bounds[0], bounds[1], bounds[2], bounds[3], srsId)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO gpkg_geometry_columns VALUES (?, 'geom', ?, ?, 0, 0)", layer.Name, layer.GeometryType, srsId)
+	return err
+}
+
+// encodeGeometry builds a GeoPackage geometry blob: the GP header with an
+// xy envelope followed by little endian WKB. The envelope is returned as
+// minX, maxX, minY, maxY, the order the header stores it in.
+func encodeGeometry(geometryType string, points [][]float64) ([]byte, [4]float64) {
+	envelope := [4]float64{math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)}
+	for _, p := range points {
+		envelope[0], envelope[1] = math.Min(envelope[0], p[0]), math.Max(envelope[1], p[0])
+		envelope[2], envelope[3] = math.Min(envelope[2], p[1]), math.Max(envelope[3], p[1])
+	}
+
+	b := []byte{'G', 'P', 0, 0x03}
+	b = binary.LittleEndian.AppendUint32(b, srsId)
+	for _, v := range envelope {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	b = append(b, 1)
+	if geometryType == Point {
+		b = binary.LittleEndian.AppendUint32(b, 1)
+		points = points[:1]
+	} else {
+		b = binary.LittleEndian.AppendUint32(b, 2)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(points)))
+	}
+	for _, p := range points {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[0]))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p[1]))
+	}
+	return b, envelope
+}
@@ -0,0 +1,174 @@
+package gpkg
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testLayers() []Layer {
+	return []Layer{
+		{
+			Name:         "trails",
+			Description:  "Trails",
+			GeometryType: LineString,
+			Columns:      []Column{{"name", "TEXT"}, {"length_km", "REAL"}},
+			Rows: []Row{
+				{Geometry: [][]float64{{-77.45, 39.52}, {-77.44, 39.53}, {-77.42, 39.51}}, Values: []interface{}{"Blue Trail", 2.5}},
+				{Geometry: [][]float64{{-77.5, 39.6}, {-77.49, 39.61}}, Values: []interface{}{"Red \"Loop\"", 1.25}},
+			},
+		},
+		{
+			Name:         "parking",
+			GeometryType: Point,
+			Columns:      []Column{{"name", "TEXT"}},
+			Rows:         []Row{{Geometry: [][]float64{{-77.43, 39.55}}, Values: []interface{}{"Lot"}}},
+		},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "trails.gpkg")
+	if err := Write(file, testLayers()); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var applicationId, userVersion int
+	if err := db.QueryRow("PRAGMA application_id").Scan(&applicationId); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("PRAGMA user_version").Scan(&userVersion); err != nil {
+		t.Fatal(err)
+	}
+	// "GPKG" as a big endian int, version 1.2
+	if applicationId != 0x47504B47 || userVersion != 10200 {
+		t.Errorf("application_id %x, user_version %d", applicationId, userVersion)
+	}
+
+	contents := map[string][4]float64{
+		"trails":  {-77.5, 39.51, -77.42, 39.61},
+		"parking": {-77.43, 39.55, -77.43, 39.55},
+	}
+	rows, err := db.Query("SELECT table_name, data_type, identifier, srs_id, min_x, min_y, max_x, max_y FROM gpkg_contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := 0
+	for rows.Next() {
+		var name, dataType, identifier string
+		var srs int
+		var bounds [4]float64
+		if err := rows.Scan(&name, &dataType, &identifier, &srs, &bounds[0], &bounds[1], &bounds[2], &bounds[3]); err != nil {
+			t.Fatal(err)
+		}
+		seen++
+		if dataType != "features" || identifier != name || srs != 4326 {
+			t.Errorf("gpkg_contents %s: %s, %s, %d", name, dataType, identifier, srs)
+		}
+		if want, ok := contents[name]; !ok || bounds != want {
+			t.Errorf("gpkg_contents %s bounds = %v, want %v", name, bounds, want)
+		}
+	}
+	rows.Close()
+	if seen != len(contents) {
+		t.Errorf("%d rows in gpkg_contents, want %d", seen, len(contents))
+	}
+
+	geometryTypes := map[string]string{"trails": "LINESTRING", "parking": "POINT"}
+	for name, want := range geometryTypes {
+		var column, geometryType string
+		var srs, z, m int
+		err := db.QueryRow("SELECT column_name, geometry_type_name, srs_id, z, m FROM gpkg_geometry_columns WHERE table_name = ?", name).Scan(&column, &geometryType, &srs, &z, &m)
+		if err != nil {
+			t.Fatalf("gpkg_geometry_columns %s: %v", name, err)
+		}
+		if column != "geom" || geometryType != want || srs != 4326 || z != 0 || m != 0 {
+			t.Errorf("gpkg_geometry_columns %s: %s %s %d %d %d", name, column, geometryType, srs, z, m)
+		}
+	}
+
+	for _, layer := range testLayers() {
+		rows, err := db.Query("SELECT * FROM " + quote(layer.Name) + " ORDER BY fid")
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := 0
+		for rows.Next() {
+			var fid int
+			var geom []byte
+			values := make([]interface{}, len(layer.Columns))
+			pointers := []interface{}{&fid, &geom}
+			for j := range values {
+				pointers = append(pointers, &values[j])
+			}
+			if err := rows.Scan(pointers...); err != nil {
+				t.Fatal(err)
+			}
+			want := layer.Rows[i]
+			if fid != i+1 {
+				t.Errorf("%s row %d fid = %d", layer.Name, i, fid)
+			}
+			if !reflect.DeepEqual(values, want.Values) {
+				t.Errorf("%s row %d values = %v, want %v", layer.Name, i, values, want.Values)
+			}
+			checkGeometry(t, geom, layer.GeometryType, want.Geometry)
+			i++
+		}
+		rows.Close()
+		if i != len(layer.Rows) {
+			t.Errorf("%s has %d rows, want %d", layer.Name, i, len(layer.Rows))
+		}
+	}
+}
+
+// checkGeometry reads a GP header with an xy envelope, then the WKB.
+func checkGeometry(t *testing.T, b []byte, geometryType string, points [][]float64) {
+	t.Helper()
+	if string(b[:2]) != "GP" || b[2] != 0 || b[3] != 0x03 {
+		t.Fatalf("header = %v, want GP, version 0, little endian with an xy envelope", b[:4])
+	}
+	if srs := binary.LittleEndian.Uint32(b[4:]); srs != 4326 {
+		t.Errorf("header srs_id = %d", srs)
+	}
+	float := func(at int) float64 {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[at:]))
+	}
+	envelope := [4]float64{float(8), float(16), float(24), float(32)}
+	want := [4]float64{math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)}
+	for _, p := range points {
+		want[0], want[1] = math.Min(want[0], p[0]), math.Max(want[1], p[0])
+		want[2], want[3] = math.Min(want[2], p[1]), math.Max(want[3], p[1])
+	}
+	if envelope != want {
+		t.Errorf("envelope = %v, want %v", envelope, want)
+	}
+
+	wkb := b[40:]
+	if wkb[0] != 1 {
+		t.Fatalf("WKB byte order = %d, want little endian", wkb[0])
+	}
+	kind := binary.LittleEndian.Uint32(wkb[1:])
+	var read [][]float64
+	switch {
+	case geometryType == Point && kind == 1:
+		read = [][]float64{{float(45), float(53)}}
+	case geometryType == LineString && kind == 2:
+		n := int(binary.LittleEndian.Uint32(wkb[5:]))
+		for i := 0; i < n; i++ {
+			read = append(read, []float64{float(49 + 16*i), float(57 + 16*i)})
+		}
+	default:
+		t.Fatalf("WKB type %d for a %s layer", kind, geometryType)
+	}
+	if !reflect.DeepEqual(read, points) {
+		t.Errorf("WKB points = %v, want %v", read, points)
+	}
+}
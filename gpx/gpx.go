@@ -0,0 +1,123 @@
+package gpx
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+)
+
+type Point struct {
+	XMLName xml.Name `xml:"trkpt"`
+	Lat     float64  `xml:"lat,attr"`
+	Lon     float64  `xml:"lon,attr"`
+}
+type Segment struct {
+	XMLName xml.Name `xml:"trkseg"`
+	Points  []Point  `xml:"trkpt"`
+}
+type Track struct {
+	XMLName     xml.Name  `xml:"trk"`
+	Name        string    `xml:"name"`
+	Description string    `xml:"desc,omitempty"`
+	Segments    []Segment `xml:"trkseg"`
+}
+type Gpx struct {
+	XMLName xml.Name `xml:"gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Name    string   `xml:"metadata>name"`
+	Tracks  []Track  `xml:"trk"`
+}
+
+func NewGpx(name string) Gpx {
+	return Gpx{Version: "1.1", Creator: "trail", Xmlns: "http://www.topografix.com/GPX/1/1", Name: name}
+}
+
+// AddTrack adds a single segment track from [lon, lat, ...] coordinates, the
+// same order the kml package uses.
+func (gpx *Gpx) AddTrack(name string, description string, coords [][]float64) {
+	var segment Segment
+	for _, coord := range coords {
+		segment.Points = append(segment.Points, Point{Lat: coord[1], Lon: coord[0]})
+	}
+	gpx.Tracks = append(gpx.Tracks, Track{Name: name, Description: description, Segments: []Segment{segment}})
+}
+
+func (gpx *Gpx) Encode(w io.Writer) error {
+	enc := NewEncoder(w)
+	if err := enc.Begin(gpx); err != nil {
+		return err
+	}
+	for _, track := range gpx.Tracks {
+		if err := enc.Track(track); err != nil {
+			return err
+		}
+	}
+	return enc.End()
+}
+
+// Encoder writes a GPX document a track at a time.
+type Encoder struct {
+	w     io.Writer
+	e     *xml.Encoder
+	start xml.StartElement
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Begin writes the xml header and the metadata of gpx, ignoring its
+// tracks. Follow it with Track for each track and then End.
+func (enc *Encoder) Begin(gpx *Gpx) error {
+	if _, err := io.WriteString(enc.w, xml.Header); err != nil {
+		return err
+	}
+	enc.e = xml.NewEncoder(enc.w)
+	enc.e.Indent("", "  ")
+	enc.start = xml.StartElement{Name: xml.Name{Local: "gpx"}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "version"}, Value: gpx.Version},
+		{Name: xml.Name{Local: "creator"}, Value: gpx.Creator},
+		{Name: xml.Name{Local: "xmlns"}, Value: gpx.Xmlns},
+	}}
+	if err := enc.e.EncodeToken(enc.start); err != nil {
+		return err
+	}
+	metadata := struct {
+		Name string `xml:"name"`
+	}{gpx.Name}
+	return enc.e.EncodeElement(metadata, xml.StartElement{Name: xml.Name{Local: "metadata"}})
+}
+
+// Track writes one track and flushes it to the stream.
+func (enc *Encoder) Track(track Track) error {
+	if err := enc.e.Encode(track); err != nil {
+		return err
+	}
+	return enc.e.Flush()
+}
+
+// End closes the document begun by Begin.
+func (enc *Encoder) End() error {
+	if err := enc.e.EncodeToken(enc.start.End()); err != nil {
+		return err
+	}
+	if err := enc.e.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(enc.w, "\n")
+	return err
+}
+
+func (gpx *Gpx) SaveFile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := gpx.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"github.com/mingram/trail/osm"
+	"html/template"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Leaflet is vendored into leaflet/ and inlined into the page, so the map
+// works with no connection but for the OSM tiles behind the trails. Run go
+// generate to fetch the version in leaflet/VERSION.
+//
+//go:generate sh -c "v=$(cat leaflet/VERSION) && curl -sfL -o leaflet/leaflet.js https://unpkg.com/leaflet@$v/dist/leaflet.js && curl -sfL -o leaflet/leaflet.css https://unpkg.com/leaflet@$v/dist/leaflet.css"
+
+//go:embed leaflet
+var leafletFiles embed.FS
+
+// leafletAssets returns the vendored Leaflet script and stylesheet, false
+// if go generate has not been run to fetch them.
+func leafletAssets() (template.JS, template.CSS, bool) {
+	js, err := leafletFiles.ReadFile("leaflet/leaflet.js")
+	if err != nil {
+		return "", "", false
+	}
+	css, err := leafletFiles.ReadFile("leaflet/leaflet.css")
+	if err != nil {
+		return "", "", false
+	}
+	return template.JS(js), template.CSS(css), true
+}
+
+type legendEntry struct {
+	Color string
+	Tipo  string
+}
+
+// writeHTML saves a single page Leaflet map of the trails with the GeoJSON
+// and Leaflet itself embedded, so it can be opened straight from disk.
+// Popups show the -balloon HTML when there is one, as KML does.
+func (opts exportOptions) writeHTML(file string, nodes [][]openStreetMap.Node) error {
+	geojson := GeoJson{Tipo: "FeatureCollection"}
+	seen := make(map[string]bool)
+	var legend []legendEntry
+	for _, node := range nodes {
+		feature := opts.trailFeature(node)
+		if opts.Balloon != nil {
+			feature.Properties.Description = opts.describeHTML(node)
+		} else {
+			feature.Properties.Description = opts.describe(node)
+		}
+		geojson.Features = append(geojson.Features, feature)
+
+		color, tipo := GetColor(node[0])
+		if !seen[tipo] {
+			seen[tipo] = true
+			legend = append(legend, legendEntry{color, tipo})
+		}
+	}
+	sort.Slice(legend, func(i, j int) bool { return legend[i].Tipo < legend[j].Tipo })
+
+	// json.Marshal escapes <, > and & so the data is safe inside <script>
+	data, err := json.Marshal(geojson)
+	if err != nil {
+		return err
+	}
+	js, css, vendored := leafletAssets()
+	if !vendored {
+		log.Print("Leaflet is not in leaflet/, run go generate; " + file + " loads it from unpkg.com")
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = htmlTemplate.Execute(f, map[string]interface{}{
+		"Title":      opts.Activity + " Trails",
+		"Legend":     legend,
+		"Data":       template.JS(data),
+		"HTML":       opts.Balloon != nil,
+		"Vendored":   vendored,
+		"LeafletJS":  js,
+		"LeafletCSS": css,
+		"Version":    leafletVersion(),
+	})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// htmlTemplate draws the map itself rather than loading Leaflet, so the
+// page needs nothing but the file: lines are SVG in Web Mercator, with OSM
+// tiles behind them when there is a connection.
+// leafletVersion is the vendored version, loaded from unpkg.com when the
+// files themselves are missing.
+func leafletVersion() string {
+	b, _ := leafletFiles.ReadFile("leaflet/VERSION")
+	return strings.TrimSpace(string(b))
+}
+
+var htmlTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{- if .Vendored}}
+<style>{{.LeafletCSS}}</style>
+<script>{{.LeafletJS}}</script>
+{{- else}}
+<link rel="stylesheet" href="https://unpkg.com/leaflet@{{.Version}}/dist/leaflet.css">
+<script src="https://unpkg.com/leaflet@{{.Version}}/dist/leaflet.js"></script>
+{{- end}}
+<style>
+html, body, #map { height: 100%; margin: 0; }
+.legend { background: white; padding: 6px 10px; font: 13px sans-serif; border-radius: 4px; }
+.legend span { display: inline-block; width: 18px; height: 4px; margin-right: 6px; vertical-align: middle; }
+.popup { white-space: pre-line; }
+</style>
+</head>
+<body>
+<div id="map"></div>
+<script>
+var trails = {{.Data}};
+var html = {{.HTML}};
+var map = L.map("map");
+L.tileLayer("https://{s}.tile.openstreetmap.org/{z}/{x}/{y}.png", {
+	maxZoom: 19,
+	attribution: "&copy; OpenStreetMap contributors"
+}).addTo(map);
+var layer = L.geoJSON(trails, {
+	style: function (feature) {
+		return {color: feature.properties.stroke, weight: 4, opacity: feature.properties["stroke-opacity"], dashArray: feature.properties["stroke-dasharray"]};
+	},
+	onEachFeature: function (feature, line) {
+		var popup = document.createElement("div");
+		var title = document.createElement("b");
+		title.textContent = feature.properties.name;
+		var body = document.createElement("div");
+		if (html) {
+			// the balloon template escapes everything it puts in
+			body.innerHTML = feature.properties.description;
+		} else {
+			body.className = "popup";
+			body.textContent = feature.properties.description;
+		}
+		popup.appendChild(title);
+		popup.appendChild(body);
+		line.bindPopup(popup, {maxWidth: 360});
+	}
+}).addTo(map);
+if (trails.features.length > 0) {
+	map.fitBounds(layer.getBounds());
+} else {
+	map.setView([39.5, -77.48], 12);
+}
+var legend = L.control({position: "bottomright"});
+legend.onAdd = function () {
+	var div = L.DomUtil.create("div", "legend");
+	div.innerHTML = document.getElementById("legend").innerHTML;
+	return div;
+};
+legend.addTo(map);
+</script>
+<template id="legend">
+{{range .Legend}}<div><span style="background: {{.Color}}"></span>{{.Tipo}}</div>
+{{end}}</template>
+</body>
+</html>
+`))
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/mingram/trail/osm"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Ids are made only from OSM ids, never from counters or randomness, so the
+// same trail gets the same id in every export and in every format. They
+// are valid XML ids, so they can go in KML id attributes as they are.
+
+// segmentId names the stretch of a way between two nodes.
+func segmentId(wayid string, from string, to string) string {
+	return "way-" + wayid + "-" + from + "-" + to
+}
+
+// endIds are the ids of the first and last nodes of a trail that came from
+// OSM. Nodes clipping adds at a boundary get negative ids numbered in the
+// order they were made, which change whenever anything else is clipped, so
+// they are skipped.
+func endIds(node []openStreetMap.Node) (string, string) {
+	from, to := node[0].Id, node[len(node)-1].Id
+	for _, nd := range node {
+		if !strings.HasPrefix(nd.Id, "-") {
+			from = nd.Id
+			break
+		}
+	}
+	for i := len(node) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(node[i].Id, "-") {
+			to = node[i].Id
+			break
+		}
+	}
+	return from, to
+}
+
+// trailId is a trail's segment id when it is one, way-<id> for a whole way
+// and the segment id of its end nodes for a piece of a way clipping cut up.
+func (opts exportOptions) trailId(node []openStreetMap.Node) string {
+	if node[0].Segment != "" {
+		return node[0].Segment
+	}
+	if opts.Pieces[node[0].Wayid] {
+		from, to := endIds(node)
+		return segmentId(node[0].Wayid, from, to)
+	}
+	return "way-" + node[0].Wayid
+}
+
+// tileId is the number a vector tile feature needs for a trail: the way id
+// for a whole way, and otherwise a hash of the trail id, since the pieces
+// of a split or clipped way would all share the way's.
+func (opts exportOptions) tileId(node []openStreetMap.Node) uint64 {
+	id := opts.trailId(node)
+	if id == "way-"+node[0].Wayid {
+		if n, err := strconv.ParseUint(node[0].Wayid, 10, 64); err == nil {
+			return n
+		}
+	}
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return h.Sum64()
+}
+
+// pieceWays are the ways that appear more than once, cut up by clipping.
+func pieceWays(nodes [][]openStreetMap.Node) map[string]bool {
+	count := make(map[string]int)
+	pieces := make(map[string]bool)
+	for _, node := range nodes {
+		count[node[0].Wayid]++
+		if count[node[0].Wayid] > 1 {
+			pieces[node[0].Wayid] = true
+		}
+	}
+	return pieces
+}
+
+// routeId hashes the nodes a route passes through, in order, so asking for
+// the same route again gives the same id.
+func routeId(nodes []openStreetMap.Node) string {
+	var ids []string
+	for _, nd := range nodes {
+		ids = append(ids, nd.Id)
+	}
+	sum := sha1.Sum([]byte(strings.Join(ids, ",")))
+	return "route-" + hex.EncodeToString(sum[:8])
+}
@@ -1,14 +1,14 @@
 package kml
 
 import (
-	"crypto/rand"
+	"bufio"
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"github.com/mingram/trail/osm"
-	"github.com/umahmood/haversine"
 	"io"
-	"io/ioutil"
 	"log"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -24,7 +24,7 @@ type Linestring struct {
 	Extrude      int         `xml:"extrude"`
 	AltitudeMode string      `xml:"altitudeMode"`
 	Tessellate   int         `xml:"tessellate"`
-	Coordinates  [][]float64 `"json:"coordinates`
+	Coordinates  [][]float64 `xml:"-" json:"coordinates"`
 }
 
 type Linestyle struct {
@@ -32,20 +32,66 @@ type Linestyle struct {
 	Color   string   `xml:"color"`
 	Width   int      `xml:"width"`
 }
+
+// BalloonStyle lays out the balloon Google Earth opens on a click. Text
+// can use $[name], $[description] and the other KML entities.
+type BalloonStyle struct {
+	XMLName     xml.Name `xml:"BalloonStyle"`
+	BgColor     string   `xml:"bgColor,omitempty"`
+	TextColor   string   `xml:"textColor,omitempty"`
+	Text        string   `xml:"text"`
+	DisplayMode string   `xml:"displayMode,omitempty"`
+}
 type Style struct {
-	XMLName   xml.Name  `xml:"Style"`
-	Id        string    `xml:"id,attr"`
-	Linestyle Linestyle `xml:"LineStyle"`
+	XMLName      xml.Name      `xml:"Style"`
+	Id           string        `xml:"id,attr"`
+	Linestyle    Linestyle     `xml:"LineStyle"`
+	BalloonStyle *BalloonStyle `xml:"BalloonStyle,omitempty"`
 }
 type Placemark struct {
 	XMLName     xml.Name             `xml:"Placemark"`
+	Id          string               `xml:"id,attr,omitempty"`
 	Name        string               `xml:"name"`
-	Id          string               `xml:"id"`
 	StyleUrl    string               `xml:"styleUrl"`
 	Description string               `xml:"description"`
 	Linestring  Linestring           `xml:"LineString"`
-	Nodes       []openStreetMap.Node `"json:"node`
+	Nodes       []openStreetMap.Node `xml:"-" json:"node"`
+	// HTML marks a description that is HTML, written as CDATA so it
+	// reaches the balloon unescaped
+	HTML bool `xml:"-" json:"html"`
+}
+
+// placemarkXML is a Placemark as it is written out.
+type placemarkXML struct {
+	XMLName     xml.Name    `xml:"Placemark"`
+	Id          string      `xml:"id,attr,omitempty"`
+	Name        string      `xml:"name"`
+	StyleUrl    string      `xml:"styleUrl"`
+	Description description `xml:"description"`
+	Linestring  Linestring  `xml:"LineString"`
+}
+
+// description holds either plain text or CDATA, whichever is set.
+type description struct {
+	Text  string `xml:",chardata"`
+	CDATA string `xml:",cdata"`
+}
+
+func (placemark Placemark) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	out := placemarkXML{
+		Name:       placemark.Name,
+		Id:         placemark.Id,
+		StyleUrl:   placemark.StyleUrl,
+		Linestring: placemark.Linestring,
+	}
+	if placemark.HTML {
+		out.Description.CDATA = placemark.Description
+	} else {
+		out.Description.Text = placemark.Description
+	}
+	return e.EncodeElement(out, start)
 }
+
 type Kml struct {
 	XMLName     xml.Name    `xml:"Document"`
 	Name        string      `xml:"name"`
@@ -59,6 +105,8 @@ type File struct {
 	Kml     Kml      `xml:"Document"`
 }
 
+const Namespace = "http://www.opengis.net/kml/2.2"
+
 func NewKml(name string, description string) Kml {
 	var kml Kml
 
@@ -103,98 +151,197 @@ func ReadKML(reader []byte) Kml {
 func (kml *Kml) SetName(name string, index int) {
 	kml.Placemarks[index].Name = name
 }
+
+// SetId gives a placemark the id attribute it can be linked to by.
+func (kml *Kml) SetId(id string, index int) {
+	kml.Placemarks[index].Id = id
+}
 func (kml *Kml) AddStyle(id string, color string, width int) {
 	defaultLinestyle := Linestyle{Color: color, Width: width}
 	defaultStyle := Style{Id: id, Linestyle: defaultLinestyle}
 	kml.Style = append(kml.Style, defaultStyle)
 }
-func (kml *Kml) AddPlacemark(name string, styleUrl string, description string, coords [][]float64, nodes []openStreetMap.Node, str string) {
-	var num int
-	for _, mark := range kml.Placemarks {
-		if name == mark.Name {
-			num++
-		}
+
+// SetBalloon gives every style the same balloon text.
+func (kml *Kml) SetBalloon(text string) {
+	for i := range kml.Style {
+		kml.Style[i].BalloonStyle = &BalloonStyle{Text: text}
 	}
+}
+
+// AddHTMLPlacemark adds a placemark whose description is HTML.
+func (kml *Kml) AddHTMLPlacemark(name string, styleUrl string, html string, coords [][]float64, nodes []openStreetMap.Node) {
+	kml.AddPlacemark(name, styleUrl, html, coords, nodes, "true")
+	kml.Placemarks[len(kml.Placemarks)-1].HTML = true
+}
+
+func (kml *Kml) AddPlacemark(name string, styleUrl string, description string, coords [][]float64, nodes []openStreetMap.Node, str string) {
 	var placemark Placemark
 	placemark.Name = name
 	placemark.StyleUrl = styleUrl
 	placemark.Description = description
+	if placemark.StyleUrl == "" {
+		placemark.StyleUrl = "default"
+	}
+	//placemark.Nodes = nodes
+
 	var linestring Linestring
-	linestring.Coordinates = [][]float64{[]float64{0.0, 0.0}, []float64{0.0, 0.0}}
+	linestring.Coordinates = coords
+	linestring.AltitudeMode = "clampToGround"
+	linestring.Tessellate = 1
+	linestring.Extrude = 1
 	placemark.Linestring = linestring
 
-	if name == "Catoctin National Recreation Trail" && num == 0 && str == "true" {
-		log.Print(coords[0][1], coords[0][0])
-		log.Print(coords[len(coords)-1][1], coords[len(coords)-1][0])
+	kml.Placemarks = append(kml.Placemarks, placemark)
+}
 
+func (kml *Kml) ConvertCoords() {
+	for i, placemark := range kml.Placemarks {
+		kml.Placemarks[i].Linestring.Coords = coordString(placemark.Linestring.Coordinates)
 	}
+}
 
-	if name == "Catoctin National Recreation Trail" && num == 2 && str == "true" {
-		log.Print(coords[0][1], coords[0][0])
-		log.Print(coords[len(coords)-1][1], coords[len(coords)-1][0])
-
+// coordString formats coordinates the way KML wants them: lon,lat,alt
+// tuples, one per line, to the 7 decimal places OSM stores like GeoJSON.
+func coordString(coords [][]float64) string {
+	var b strings.Builder
+	for _, coord := range coords {
+		for i, c := range coord {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(fmt.Sprintf("%.7f", c)) // s == "123.4560000"
+		}
+		b.WriteByte('\n')
 	}
+	return b.String()
+}
 
-	if strings.Index(name, "Blue Balls") != -1 || strings.Index(name, "Access to Freeride") != -1 {
+// Encoder writes KML documents to a stream, one placemark at a time, so
+// big documents never have to be held in memory as XML.
+type Encoder struct {
+	w      io.Writer
+	prefix string
+	indent string
+	e      *xml.Encoder
+}
 
-		if styleUrl == "" {
-			styleUrl = "default"
-		}
-		if description == "" {
-			description = "default placemark"
-		}
-		if name == "" {
-			name = "default placemark"
-		}
-		//placemark.Nodes = nodes
+var (
+	kmlStart      = xml.StartElement{Name: xml.Name{Local: "kml"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Namespace}}}
+	documentStart = xml.StartElement{Name: xml.Name{Local: "Document"}}
+)
 
-		placemark.Id = fmt.Sprintf("%v", num)
-		linestring.Coordinates = coords
-		linestring.AltitudeMode = "clampToGround"
-		linestring.Tessellate = 1
-		linestring.Extrude = 1
-		placemark.Linestring = linestring
+// NewEncoder returns an encoder that indents with two spaces, call Indent
+// to change that.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, indent: "  "}
+}
+
+// Indent works like xml.Encoder.Indent; two empty strings turn indenting
+// off.
+func (enc *Encoder) Indent(prefix string, indent string) {
+	enc.prefix, enc.indent = prefix, indent
+}
 
-		kml.Placemarks = append(kml.Placemarks, placemark)
+// Encode writes the xml header and the whole document. The Kml is left
+// untouched.
+func (enc *Encoder) Encode(kml *Kml) error {
+	if err := enc.Begin(kml); err != nil {
+		return err
+	}
+	for _, placemark := range kml.Placemarks {
+		if err := enc.Placemark(placemark); err != nil {
+			return err
+		}
 	}
+	return enc.End()
 }
 
-func (kml *Kml) ConvertCoords() {
-	for i, placemark := range kml.Placemarks {
-		var coordinates string
-		for _, coord := range placemark.Linestring.Coordinates {
-			for i, c := range coord {
-				s := fmt.Sprintf("%f", c) // s == "123.456000"
-				remainder := i % 3
-				if remainder != 2 {
-					coordinates += s + ","
-				} else {
-					coordinates += s + "\n"
-				}
-			}
+// Begin writes the xml header and everything in the document up to its
+// placemarks, which are ignored. Follow it with Placemark for each
+// placemark and then End.
+func (enc *Encoder) Begin(kml *Kml) error {
+	if _, err := io.WriteString(enc.w, xml.Header); err != nil {
+		return err
+	}
+	enc.e = xml.NewEncoder(enc.w)
+	enc.e.Indent(enc.prefix, enc.indent)
+	if err := enc.e.EncodeToken(kmlStart); err != nil {
+		return err
+	}
+	if err := enc.e.EncodeToken(documentStart); err != nil {
+		return err
+	}
+	if err := enc.e.EncodeElement(kml.Name, xml.StartElement{Name: xml.Name{Local: "name"}}); err != nil {
+		return err
+	}
+	if err := enc.e.EncodeElement(kml.Description, xml.StartElement{Name: xml.Name{Local: "description"}}); err != nil {
+		return err
+	}
+	if err := enc.e.Encode(kml.Timespan); err != nil {
+		return err
+	}
+	for _, style := range kml.Style {
+		if err := enc.e.Encode(style); err != nil {
+			return err
 		}
-		kml.Placemarks[i].Linestring.Coords = coordinates
+	}
+	return nil
+}
 
+// Placemark writes one placemark and flushes it to the stream.
+func (enc *Encoder) Placemark(placemark Placemark) error {
+	// placemark is a copy, filling in Coords does not touch the caller's
+	if len(placemark.Linestring.Coordinates) > 0 {
+		placemark.Linestring.Coords = coordString(placemark.Linestring.Coordinates)
+	}
+	if err := enc.e.Encode(placemark); err != nil {
+		return err
 	}
+	return enc.e.Flush()
 }
-func (kml *Kml) ToXML() []byte {
-	kml.ConvertCoords()
-	doc := &File{Kml: *kml}
-	xml, _ := xml.Marshal(doc)
 
-	return xml
+// End closes the document begun by Begin.
+func (enc *Encoder) End() error {
+	if err := enc.e.EncodeToken(documentStart.End()); err != nil {
+		return err
+	}
+	if err := enc.e.EncodeToken(kmlStart.End()); err != nil {
+		return err
+	}
+	if err := enc.e.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(enc.w, "\n")
+	return err
 }
-func (kml *Kml) SaveFile(file string) {
-	kml.ConvertCoords()
-	doc := &File{Kml: *kml}
-	xml, _ := xml.Marshal(doc)
-	//j :=  []byte(json)
-	//log.Print(string(j))
 
-	err := ioutil.WriteFile(file, xml, 0644)
+// Encode writes the document to w with the default indenting.
+func (kml *Kml) Encode(w io.Writer) error {
+	return NewEncoder(w).Encode(kml)
+}
+
+func (kml *Kml) ToXML() ([]byte, error) {
+	var b bytes.Buffer
+	err := kml.Encode(&b)
+	return b.Bytes(), err
+}
+
+func (kml *Kml) SaveFile(file string) error {
+	f, err := os.Create(file)
 	if err != nil {
-		log.Print(err)
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := kml.Encode(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
 }
 
 func compareCoords(a, b [][]float64) bool {
@@ -218,249 +365,3 @@ func compareCoords(a, b [][]float64) bool {
 
 	return true
 }
-
-func (kml *Kml) SortPlacemarkers() {
-	trails := make(map[string][]Placemark)
-	//sort.Slice(kml.Placemarks, func(i, j int) bool {
-	//	return kml.Placemarks[i].Name > kml.Placemarks[j].Name
-	//})
-	//for _, v := range kml.Placemarks {
-	//	log.Print(v.Name)
-	//}
-	for _, mark := range kml.Placemarks {
-		if len(trails[mark.Name]) == 0 {
-			trails[mark.Name] = []Placemark{mark}
-		} else {
-			trails[mark.Name] = append(trails[mark.Name], mark)
-		}
-	}
-
-	//for k, _ := range trails {
-	//	sort.Slice(trails[k], func(i, j int) bool {
-	//		//name := trails[k][i].Name
-	//		coords1 := trails[k][i].Linestring.Coordinates
-	//		coords2 := trails[k][j].Linestring.Coordinates
-	//		if coords1[0][1] > coords2[0][1] {
-	//			return true
-	//		} else {
-	//			return false
-	//		}
-	//	})
-	//}
-	//var placemarks []Placemark
-	//log.Print(trails["Catoctin National Recreation Trail"])
-
-	for k, _ := range trails {
-		//furthest := 0.0
-		furthestId := ""
-		if k == "Catoctin National Recreation Trail" {
-			placemark := Lineup(trails[k])
-			kml.Placemarks = []Placemark{placemark}
-		}
-		//for i, val := range trails[k] {
-		//	//var placemark Placemark
-		//	//newCoord := val.Linestring.Coordinates
-		//	end_1 := val.Linestring.Coordinates[len(val.Linestring.Coordinates)-1]
-		//	begin_1 := val.Linestring.Coordinates[0]
-		//
-		//	if val.Name == "Catoctin National Recreation Trail" {
-		//		dis := distance(39.4917075, -77.4841673, 39.4992146, -77.4831109)
-		//		log.Print("distance", dis)
-		//		log.Print("index ", fmt.Sprintf("%v", i), "lat ", fmt.Sprintf("%v", val.Linestring.Coordinates[0][1]), " lon ", fmt.Sprintf("%v", val.Linestring.Coordinates[0][0]))
-		//		log.Print("index ", fmt.Sprintf("%v", i), "lat ", fmt.Sprintf("%v", end_1[1]), " lon ", fmt.Sprintf("%v", end_1[0]))
-		//
-		//	}
-		//	//begin_1 := val.Linestring.Coordinates[0]
-		//	//
-		//	//dir := ""
-		//	underOne := false
-		//	for _, mark := range trails[k] {
-		//		begin_2 := mark.Linestring.Coordinates[0]
-		//		end_2 := mark.Linestring.Coordinates[len(mark.Linestring.Coordinates)-1]
-		//		if mark.Id != val.Id {
-		//			d_start := distance(end_1[1], end_1[0], begin_2[1], begin_2[0])
-		//			d_end := distance(begin_1[1], begin_1[0], end_2[1], end_2[0])
-		//			d_start_to_start := distance(begin_1[1], begin_1[0], begin_2[1], begin_2[0])
-		//			d_end_to_end := distance(end_1[1], end_1[0], end_2[1], end_2[0])
-		//
-		//			//log.Print(d_start_to_start)
-		//			//log.Print(d_end_to_end)
-		//			//d_end := distance(begin_1[1], begin_1[0], end_2[1], end_2[0])
-		//			if d_start == 0 {
-		//				log.Print("end to start")
-		//				log.Print(val.Id, ",", mark.Id)
-		//			}
-		//			if d_end == 0 {
-		//				log.Print("start to end")
-		//				log.Print(val.Id, ",", mark.Id)
-		//			}
-		//			if d_start_to_start == 0 {
-		//				log.Print("start to start")
-		//				log.Print(val.Id, ",", mark.Id)
-		//			}
-		//			if d_end_to_end == 0 {
-		//				log.Print("end to end")
-		//				log.Print(val.Id, ",", mark.Id)
-		//			}
-		//			if d_start < 1 {
-		//				underOne = true
-		//				if val.Name == "Catoctin National Recreation Trail" {
-		//					//log.Print(d_start)
-		//					//log.Print(end_1[1], end_1[0], begin_2[1], begin_2[0])
-		//				}
-		//			}
-		//
-		//		}
-		//	}
-		//
-		//	if underOne == false && val.Name == "Catoctin National Recreation Trail" {
-		//		furthestId = val.Id
-		//	}
-		//	//placemark.Linestring.Coordinates = newCoord
-		//	//placemarks = append(placemarks, placemark)
-		//
-		//}
-		if trails[k][0].Name == "Catoctin National Recreation Trail" {
-			log.Print("furthest")
-			log.Print(furthestId)
-		}
-		//	newTrail := trails[k][0]
-		//	var coords [][]float64
-		//	for _, mark := range trails[k] {
-		//			coords = append(coords,mark.Linestring.Coordinates...)
-		//	}
-		//	sort.Slice(coords, func(i, j int) bool {
-		//		//name := trails[k][i].Name
-		//		coords1 := coords[i]
-		//		coords2 := coords[j]
-		//		if coords1
-		//		if d < .3 {
-		//			return true
-		//		}
-		//		return false
-		//	})
-		//	newTrail.Linestring.Coordinates = coords
-		//	placemarks = append(placemarks, newTrail)
-
-		//var placemark Placemark
-		//for i, mark := range trails[k] {
-		//	if mark.Name == "Yellow Poplar Trail" {
-		//		log.Print(mark.Linestring.Coordinates)
-		//	}
-		//	if i > 0 {
-		//		placemark.Linestring.Coordinates = append(placemark.Linestring.Coordinates, mark.Linestring.Coordinates...)
-		//	} else {
-		//		placemark = mark
-		//	}
-		//}
-		//
-		//placemarks = append(placemarks, placemark)
-
-	}
-
-	//kml.Placemarks = placemarks
-
-}
-
-func distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
-	pos1 := haversine.Coord{Lat: lat1, Lon: lon1} //
-	pos2 := haversine.Coord{Lat: lat2, Lon: lon2} //
-	_, km := haversine.Distance(pos1, pos2)
-
-	return km
-}
-func Lineup(placemarks []Placemark) Placemark {
-	var newPlaces []Placemark
-	var oldPlaces []Placemark
-
-	log.Print("length ", len(placemarks))
-	placemark := placemarks[0]
-	for i, val := range placemarks {
-		end_1 := val.Linestring.Coordinates[len(val.Linestring.Coordinates)-1]
-		begin_1 := val.Linestring.Coordinates[0]
-		var newCoords [][]float64
-		for x, mark := range placemarks {
-			log.Print(len(mark.Linestring.Coordinates))
-			begin_2 := mark.Linestring.Coordinates[0]
-			log.Print(len(mark.Linestring.Coordinates) - 1)
-			end_2 := mark.Linestring.Coordinates[len(mark.Linestring.Coordinates)-1]
-			if mark.Id != val.Id {
-				d_start := distance(end_1[1], end_1[0], begin_2[1], begin_2[0])
-				d_end := distance(begin_1[1], begin_1[0], end_2[1], end_2[0])
-				d_start_to_start := distance(begin_1[1], begin_1[0], begin_2[1], begin_2[0])
-				d_end_to_end := distance(end_1[1], end_1[0], end_2[1], end_2[0])
-
-				if d_start == 0 {
-					oldPlaces = append(placemarks[:x], placemarks[x+1:]...)
-					newPlaces = append(placemarks[:i], placemarks[i+1:]...)
-					newPlaces = append(newPlaces, oldPlaces...)
-					newPlaces = unique(newPlaces)
-					placemark.Linestring.Coordinates = newCoords
-					newPlaces = append(newPlaces, placemark)
-					return Lineup(newPlaces)
-				} else if d_end == 0 {
-					oldPlaces = append(placemarks[:x], placemarks[x+1:]...)
-					newPlaces = append(placemarks[:i], placemarks[i+1:]...)
-					newPlaces = append(newPlaces, oldPlaces...)
-					newPlaces = unique(newPlaces)
-					placemark.Linestring.Coordinates = newCoords
-					newPlaces = append(newPlaces, placemark)
-					return Lineup(newPlaces)
-				} else if d_start_to_start == 0 {
-					newLine := [][]float64{}
-					for i := len(val.Linestring.Coordinates) - 1; i > 0; i-- {
-						newLine = append(newLine, val.Linestring.Coordinates[i])
-					}
-					oldPlaces = append(placemarks[:x], placemarks[x+1:]...)
-					newPlaces = append(placemarks[:i], placemarks[i+1:]...)
-					newPlaces = append(newPlaces, oldPlaces...)
-					newPlaces = unique(newPlaces)
-					placemark.Linestring.Coordinates = newCoords
-					newPlaces = append(newPlaces, placemark)
-					return Lineup(newPlaces)
-
-				} else if d_end_to_end == 0 {
-					newLine := [][]float64{}
-					for i := len(mark.Linestring.Coordinates) - 1; i > 0; i-- {
-						newLine = append(newLine, mark.Linestring.Coordinates[i])
-					}
-					oldPlaces = append(placemarks[:x], placemarks[x+1:]...)
-					newPlaces = append(placemarks[:i], placemarks[i+1:]...)
-					newPlaces = append(newPlaces, oldPlaces...)
-					newPlaces = unique(newPlaces)
-					newCoords = append(val.Linestring.Coordinates, newLine...)
-					placemark.Linestring.Coordinates = newCoords
-					newPlaces = append(newPlaces, placemark)
-
-					return Lineup(newPlaces)
-				}
-			}
-		}
-	}
-	return placemark
-
-}
-func unique(floatSlice []Placemark) []Placemark {
-	keys := make(map[string]bool)
-	list := []Placemark{}
-	for _, entry := range floatSlice {
-		if _, value := keys[entry.Id]; !value {
-			keys[entry.Id] = true
-			list = append(list, entry)
-		}
-	}
-	return list
-}
-
-func NewUUID() (string, error) {
-	uuid := make([]byte, 16)
-	n, err := io.ReadFull(rand.Reader, uuid)
-	if n != len(uuid) || err != nil {
-		return "", err
-	}
-	// variant bits; see section 4.1.1
-	uuid[8] = uuid[8]&^0xc0 | 0x80
-	// version 4 (pseudo-random); see section 4.1.3
-	uuid[6] = uuid[6]&^0xf0 | 0x40
-	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
-}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mingram/trail/osm"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var layouts = []string{"way", "park", "trail", "tile"}
+
+type ManifestEntry struct {
+	File   string       `json:"file"`
+	Title  string       `json:"title"`
+	Trails int          `json:"trails"`
+	Ways   []string     `json:"ways"`
+	State  []TrailState `json:"state,omitempty"`
+}
+
+// TrailState is what a trail in a file was derived as. Naming, parks and
+// splitting can change it without its way changing, so update compares it
+// with the last export.
+type TrailState struct {
+	Way     string `json:"way"`
+	Name    string `json:"name"`
+	Park    string `json:"park,omitempty"`
+	Segment string `json:"segment,omitempty"`
+}
+
+func trailState(node []openStreetMap.Node) TrailState {
+	return TrailState{Way: node[0].Wayid, Name: node[0].Name, Park: node[0].Park, Segment: node[0].Segment}
+}
+type Manifest struct {
+	Layout string          `json:"layout"`
+	Type   string          `json:"type"`
+	Files  []ManifestEntry `json:"files"`
+}
+
+// Add lists a file, replacing any earlier entry for the same file.
+func (manifest *Manifest) Add(file string, title string, trails [][]openStreetMap.Node) {
+	entry := ManifestEntry{File: file, Title: title, Trails: len(trails)}
+	for _, trail := range trails {
+		entry.Ways = append(entry.Ways, trail[0].Wayid)
+		entry.State = append(entry.State, trailState(trail))
+	}
+	for i := range manifest.Files {
+		if manifest.Files[i].File == file {
+			manifest.Files[i] = entry
+			return
+		}
+	}
+	manifest.Files = append(manifest.Files, entry)
+}
+
+func LoadManifest(file string) (Manifest, error) {
+	var manifest Manifest
+	byteValue, err := ioutil.ReadFile(file)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(byteValue, &manifest)
+	return manifest, err
+}
+
+func (manifest *Manifest) SaveFile(file string) error {
+	json, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, json, 0644)
+}
+
+// sortTrails orders the trails by name, then way id, then first node id, so
+// the same extract always gives byte identical output whatever order the
+// ways were read in.
+func sortTrails(ways []openStreetMap.Way, nodes [][]openStreetMap.Node) {
+	sort.Stable(trailOrder{ways, nodes})
+}
+
+type trailOrder struct {
+	ways  []openStreetMap.Way
+	nodes [][]openStreetMap.Node
+}
+
+func (t trailOrder) Len() int {
+	return len(t.nodes)
+}
+
+func (t trailOrder) Swap(i, j int) {
+	t.ways[i], t.ways[j] = t.ways[j], t.ways[i]
+	t.nodes[i], t.nodes[j] = t.nodes[j], t.nodes[i]
+}
+
+func (t trailOrder) Less(i, j int) bool {
+	a, b := t.nodes[i][0], t.nodes[j][0]
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	if a.Wayid != b.Wayid {
+		return idLess(a.Wayid, b.Wayid)
+	}
+	return idLess(a.Id, b.Id)
+}
+
+// idLess compares OSM ids as numbers when they are, so way 99 comes before
+// way 100.
+func idLess(a string, b string) bool {
+	x, errX := strconv.ParseInt(a, 10, 64)
+	y, errY := strconv.ParseInt(b, 10, 64)
+	if errX != nil || errY != nil {
+		return a < b
+	}
+	return x < y
+}
+
+// groupTrails splits the trails into output documents for the layout. Keys
+// come back in the order they were first seen.
+func groupTrails(layout string, nodes [][]openStreetMap.Node, zoom int) (map[string][]int, []string) {
+	groups := make(map[string][]int)
+	var keys []string
+	for i, node := range nodes {
+		key := layoutKey(layout, node, zoom)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+	return groups, keys
+}
+
+func layoutKey(layout string, node []openStreetMap.Node, zoom int) string {
+	switch layout {
+	case "park":
+		if node[0].Park == "" {
+			return "No Park"
+		}
+		return node[0].Park
+	case "trail":
+		if node[0].Name == "" {
+			return "Unnamed Trails"
+		}
+		return node[0].Name
+	case "tile":
+		mid := node[len(node)/2]
+		x, y := tileXY(mid.Lon, mid.Lat, zoom)
+		return fmt.Sprintf("%d/%d/%d", zoom, x, y)
+	}
+	return wayFileName(node)
+}
+
+// wayFileName is the original one file per way naming. It goes through
+// safeFileName like every other key, as names can hold anything.
+func wayFileName(node []openStreetMap.Node) string {
+	start, end := []string{fmt.Sprintf("%f", node[0].Lon), fmt.Sprintf("%f", node[0].Lat)}, []string{fmt.Sprintf("%f", node[len(node)-1].Lon), fmt.Sprintf("%f", node[len(node)-1].Lat)} // s == "123.456000"
+	name := strings.Replace(node[0].Name, "/", "-", -1)
+	return name + "-Start-" + start[0] + "," + start[1] + "End-" + end[0] + "," + end[1]
+}
+
+// fileNames maps each group key to a file name without extension. Keys that
+// clean up to the same name get -2, -3... in sorted key order so reruns
+// always pick the same file for the same key.
+func fileNames(keys []string) map[string]string {
+	names := make(map[string]string)
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	used := make(map[string]bool)
+	for _, key := range sorted {
+		base := safeFileName(key)
+		name := base
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[name] = true
+		names[key] = name
+	}
+	return names
+}
+
+func safeFileName(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	name := strings.TrimRight(b.String(), "-")
+	if name == "" {
+		return "unnamed"
+	}
+	return name
+}
+
+func tileXY(lon float64, lat float64, zoom int) (int, int) {
+	n := math.Exp2(float64(zoom))
+	x := int((lon + 180) / 360 * n)
+	rad := lat * math.Pi / 180
+	y := int((1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * n)
+	return x, y
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mingram/trail/kml"
+	"github.com/mingram/trail/network"
+	"github.com/mingram/trail/osm"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The checks the lint command runs.
+const (
+	CheckMissingName  = "missing_name"
+	CheckPathAccess   = "path_without_access"
+	CheckMtbScale     = "bicycle_without_mtb_scale"
+	CheckSurface      = "surface"
+	CheckDisconnected = "disconnected"
+	CheckGap          = "gap"
+	CheckShortWay     = "short_way"
+
+	// ways shorter than this, in km, are likely leftovers from splitting
+	shortWayKm = 0.02
+)
+
+// surfaces are the surface values the OSM wiki documents.
+var surfaces = map[string]bool{
+	"paved": true, "asphalt": true, "chipseal": true, "concrete": true, "concrete:plates": true,
+	"concrete:lanes": true, "paving_stones": true, "sett": true, "cobblestone": true, "metal": true,
+	"wood": true, "stepping_stones": true, "rubber": true, "unpaved": true, "compacted": true,
+	"fine_gravel": true, "gravel": true, "shells": true, "rock": true, "pebblestone": true,
+	"ground": true, "dirt": true, "earth": true, "grass": true, "grass_paver": true, "mud": true,
+	"sand": true, "woodchips": true, "snow": true, "ice": true, "salt": true, "clay": true,
+}
+
+var pavedSurfaces = map[string]bool{
+	"paved": true, "asphalt": true, "chipseal": true, "concrete": true, "concrete:plates": true,
+	"concrete:lanes": true, "paving_stones": true, "sett": true, "cobblestone": true, "metal": true,
+	"wood": true, "rubber": true,
+}
+
+// Problem is one thing worth fixing in OSM, found on a single way.
+type Problem struct {
+	Way     string  `json:"way"`
+	Name    string  `json:"name"`
+	Check   string  `json:"check"`
+	Message string  `json:"message"`
+	Lon     float64 `json:"lon"`
+	Lat     float64 `json:"lat"`
+	// trail is the index of the way in the slices lint was given
+	trail int
+}
+
+// lint runs every check over the classified trails, given the networks and
+// gaps found in them. Problems come back in trail order, which sortTrails
+// keeps stable.
+func (opts exportOptions) lint(ways []openStreetMap.Way, nodes [][]openStreetMap.Node, components [][]int, gaps []network.Gap) []Problem {
+	var problems []Problem
+	addAt := func(i int, check string, message string, at openStreetMap.Node) {
+		problems = append(problems, Problem{Way: ways[i].Id, Name: nodes[i][0].Name, Check: check, Message: message, Lon: at.Lon, Lat: at.Lat, trail: i})
+	}
+	add := func(i int, check string, message string) {
+		addAt(i, check, message, nodes[i][len(nodes[i])/2])
+	}
+
+	// everything outside the longest network is a fragment
+	fragment := make(map[int]string)
+	for _, component := range fragments(components) {
+		km := 0.0
+		for _, i := range component {
+			km += opts.trailLength(nodes[i])
+		}
+		for _, i := range component {
+			fragment[i] = fmt.Sprintf("in a fragment of %d trails, %.2f km, not joined to the main network of %d trails", len(component), km, len(components[0]))
+		}
+	}
+	trailGaps := make(map[int][]network.Gap)
+	for _, gap := range gaps {
+		trailGaps[gap.Trail] = append(trailGaps[gap.Trail], gap)
+	}
+
+	// a named trail is expected to be all paved or all unpaved
+	paved := make(map[string]map[bool]int)
+	for _, way := range ways {
+		types := openStreetMap.TagMap(way.Tags)
+		if surface := types["surface"]; surface != "" && types["name"] != "" {
+			if paved[types["name"]] == nil {
+				paved[types["name"]] = make(map[bool]int)
+			}
+			paved[types["name"]][pavedSurfaces[surface]]++
+		}
+	}
+
+	for i, way := range ways {
+		types := openStreetMap.TagMap(way.Tags)
+		if types["name"] == "" {
+			add(i, CheckMissingName, "no name tag")
+		}
+		if types["highway"] == "path" && types["access"] == "" && types["foot"] == "" && types["bicycle"] == "" && types["horse"] == "" {
+			add(i, CheckPathAccess, "highway=path without access, foot, bicycle or horse")
+		}
+		bicycle := types["bicycle"]
+		if (bicycle == "yes" || bicycle == "designated" || bicycle == "permissive") && types["mtb:scale"] == "" && types["mtb:scale:imba"] == "" {
+			add(i, CheckMtbScale, "bicycle="+bicycle+" without mtb:scale")
+		}
+		if surface := types["surface"]; surface != "" {
+			if !surfaces[surface] {
+				add(i, CheckSurface, "unusual surface="+surface)
+			} else if counts := paved[types["name"]]; counts[true] > 0 && counts[false] > 0 {
+				kind := "unpaved"
+				if pavedSurfaces[surface] {
+					kind = "paved"
+				}
+				add(i, CheckSurface, fmt.Sprintf("surface=%s is %s, other ways of %s are not", surface, kind, types["name"]))
+			}
+		}
+		if message, ok := fragment[i]; ok {
+			add(i, CheckDisconnected, message)
+		}
+		for _, gap := range trailGaps[i] {
+			addAt(i, CheckGap, fmt.Sprintf("ends %.1f m from %s (way %s) without joining it", gap.Metres, nodes[gap.Other][0].Name, ways[gap.Other].Id), gap.End)
+		}
+		if length := opts.trailLength(nodes[i]); length < shortWayKm {
+			add(i, CheckShortWay, fmt.Sprintf("only %.1f m long", length*1000))
+		}
+	}
+	return problems
+}
+
+// fragments are every network but the longest.
+func fragments(components [][]int) [][]int {
+	if len(components) < 2 {
+		return nil
+	}
+	return components[1:]
+}
+
+// writeLintReport saves the problems as JSON when the file ends in .json
+// and CSV otherwise.
+func writeLintReport(file string, problems []Problem) error {
+	if strings.HasSuffix(strings.ToLower(file), ".json") {
+		json, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, json, 0644)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"way", "name", "check", "message", "lon", "lat"})
+	for _, p := range problems {
+		w.Write([]string{p.Way, p.Name, p.Check, p.Message, fmt.Sprintf("%f", p.Lon), fmt.Sprintf("%f", p.Lat)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeLintKML draws every way with a problem in red, one placemark per
+// problem, linking back to the way on openstreetmap.org.
+func writeLintKML(file string, nodes [][]openStreetMap.Node, problems []Problem) error {
+	KML := kml.NewKml("Trail problems", "OSM tagging problems found by trail lint")
+	KML.AddStyle("problem", "FF0000FF", 5)
+	for _, p := range problems {
+		var coords [][]float64
+		for _, nd := range nodes[p.trail] {
+			coords = append(coords, []float64{nd.Lon, nd.Lat, 0.0})
+		}
+		description := p.Message + "\nhttps://www.openstreetmap.org/way/" + p.Way
+		KML.AddPlacemark(p.Check+": "+p.Name, "#problem", description, coords, nodes[p.trail], "true")
+	}
+	return KML.SaveFile(file)
+}
+
+// writeNetworkKML is the connectivity layer: trails cut off from the main
+// network in one style, and a short line across every gap from the loose
+// end to the trail it nearly meets.
+func writeNetworkKML(file string, nodes [][]openStreetMap.Node, components [][]int, gaps []network.Gap) error {
+	KML := kml.NewKml("Trail network", fmt.Sprintf("%d separate networks, %d likely gaps", len(components), len(gaps)))
+	KML.AddStyle("fragment", "FF00A5FF", 4)
+	KML.AddStyle("gap", "FF0000FF", 6)
+	for n, component := range fragments(components) {
+		for _, i := range component {
+			var coords [][]float64
+			for _, nd := range nodes[i] {
+				coords = append(coords, []float64{nd.Lon, nd.Lat, 0.0})
+			}
+			description := fmt.Sprintf("Network %d of %d, %d trails\nhttps://www.openstreetmap.org/way/%s", n+2, len(components), len(component), nodes[i][0].Wayid)
+			KML.AddPlacemark(nodes[i][0].Name, "#fragment", description, coords, nodes[i], "true")
+		}
+	}
+	for _, gap := range gaps {
+		coords := [][]float64{{gap.End.Lon, gap.End.Lat, 0.0}, {gap.Point[0], gap.Point[1], 0.0}}
+		description := fmt.Sprintf("%.1f m between %s and %s\nhttps://www.openstreetmap.org/node/%s", gap.Metres, nodes[gap.Trail][0].Name, nodes[gap.Other][0].Name, gap.End.Id)
+		KML.AddPlacemark("Gap: "+nodes[gap.Trail][0].Name, "#gap", description, coords, nil, "true")
+	}
+	return KML.SaveFile(file)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/network"
+	"github.com/mingram/trail/osm"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// lintWay is way id with tags, running east along 39.52 through nodes
+// placed at the given longitudes, named 1, 2, ... after their place in lons
+// plus first.
+func lintWay(id string, tags map[string]string, first int, lons ...float64) (openStreetMap.Way, []openStreetMap.Node) {
+	way := openStreetMap.Way{Id: id}
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		way.Tags = append(way.Tags, openStreetMap.Tag{Key: k, Value: tags[k]})
+	}
+	var node []openStreetMap.Node
+	for i, lon := range lons {
+		nd := openStreetMap.Node{Id: string(rune('a' + first + i)), Lon: lon, Lat: 39.52}
+		nd.Name = tags["name"]
+		nd.Wayid = id
+		node = append(node, nd)
+	}
+	return way, node
+}
+
+// checks lists each problem as "way check".
+func checks(problems []Problem) []string {
+	var found []string
+	for _, p := range problems {
+		found = append(found, p.Way+" "+p.Check)
+	}
+	return found
+}
+
+func TestLintTags(t *testing.T) {
+	tests := []struct {
+		tags map[string]string
+		want []string
+	}{
+		{map[string]string{"name": "Blue", "highway": "path", "foot": "yes"}, nil},
+		{map[string]string{"highway": "path", "foot": "yes"}, []string{"1 " + CheckMissingName}},
+		{map[string]string{"name": "Blue", "highway": "path"}, []string{"1 " + CheckPathAccess}},
+		{map[string]string{"name": "Blue", "highway": "path", "access": "no"}, nil},
+		{map[string]string{"name": "Blue", "highway": "track", "bicycle": "designated"}, []string{"1 " + CheckMtbScale}},
+		{map[string]string{"name": "Blue", "highway": "track", "bicycle": "yes", "mtb:scale": "1"}, nil},
+		{map[string]string{"name": "Blue", "highway": "track", "bicycle": "permissive", "mtb:scale:imba": "1"}, nil},
+		{map[string]string{"name": "Blue", "highway": "track", "bicycle": "no"}, nil},
+		{map[string]string{"name": "Blue", "highway": "track", "surface": "gravel"}, nil},
+		{map[string]string{"name": "Blue", "highway": "track", "surface": "tarmac"}, []string{"1 " + CheckSurface}},
+		{map[string]string{"highway": "path", "bicycle": "yes", "surface": "slabs"}, []string{"1 " + CheckMissingName, "1 " + CheckMtbScale, "1 " + CheckSurface}},
+	}
+	opts := exportOptions{Metric: geo.Haversine}
+	for _, test := range tests {
+		way, node := lintWay("1", test.tags, 0, -77.45, -77.449)
+		got := checks(opts.lint([]openStreetMap.Way{way}, [][]openStreetMap.Node{node}, [][]int{{0}}, nil))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("lint(%v) = %v, want %v", test.tags, got, test.want)
+		}
+	}
+}
+
+func TestLintSurfaceMix(t *testing.T) {
+	var ways []openStreetMap.Way
+	var nodes [][]openStreetMap.Node
+	for i, tags := range []map[string]string{
+		{"name": "Blue", "highway": "track", "surface": "asphalt"},
+		{"name": "Blue", "highway": "track", "surface": "dirt"},
+		{"name": "Blue", "highway": "track"},
+		{"name": "Red", "highway": "track", "surface": "asphalt"},
+	} {
+		way, node := lintWay(string(rune('1'+i)), tags, 2*i, -77.45+float64(i)*0.001, -77.449+float64(i)*0.001)
+		ways, nodes = append(ways, way), append(nodes, node)
+	}
+	problems := exportOptions{Metric: geo.Haversine}.lint(ways, nodes, [][]int{{0, 1, 2, 3}}, nil)
+	var messages []string
+	for _, p := range problems {
+		messages = append(messages, p.Way+" "+p.Message)
+	}
+	want := []string{
+		"1 surface=asphalt is paved, other ways of Blue are not",
+		"2 surface=dirt is unpaved, other ways of Blue are not",
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("lint of mixed surfaces = %v, want %v", messages, want)
+	}
+}
+
+func TestLintNetwork(t *testing.T) {
+	tags := func(name string) map[string]string {
+		return map[string]string{"name": name, "highway": "track", "surface": "dirt"}
+	}
+	// Blue and Red meet at their shared node; Spur stops short of Red and
+	// is under 20 m long
+	blue, blueNodes := lintWay("1", tags("Blue"), 0, -77.45, -77.449)
+	red, redNodes := lintWay("2", tags("Red"), 1, -77.449, -77.448)
+	spur, spurNodes := lintWay("3", tags("Spur"), 5, -77.4485, -77.4484)
+	redNodes[0].Id = blueNodes[1].Id
+	for i := range spurNodes {
+		spurNodes[i].Lat += 0.0001
+	}
+	ways := []openStreetMap.Way{blue, red, spur}
+	nodes := [][]openStreetMap.Node{blueNodes, redNodes, spurNodes}
+	gap := network.Gap{Trail: 2, End: spurNodes[0], Other: 1, Point: []float64{-77.4485, 39.52}, Metres: 11.1}
+
+	problems := exportOptions{Metric: geo.Haversine}.lint(ways, nodes, [][]int{{0, 1}, {2}}, []network.Gap{gap})
+	want := []string{"3 " + CheckDisconnected, "3 " + CheckGap, "3 " + CheckShortWay}
+	if got := checks(problems); !reflect.DeepEqual(got, want) {
+		t.Fatalf("lint of the network = %v, want %v", got, want)
+	}
+	if p := problems[1]; p.Message != "ends 11.1 m from Red (way 2) without joining it" || p.Lon != gap.End.Lon || p.Lat != gap.End.Lat {
+		t.Errorf("gap problem = %q at %f, %f", p.Message, p.Lon, p.Lat)
+	}
+	if p := problems[0]; p.Message != "in a fragment of 1 trails, 0.01 km, not joined to the main network of 2 trails" {
+		t.Errorf("disconnected problem = %q", p.Message)
+	}
+	if p := problems[2]; p.Message != "only 8.6 m long" {
+		t.Errorf("short way problem = %q", p.Message)
+	}
+}
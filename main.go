@@ -1,16 +1,21 @@
 package main
 
 import (
-	"encoding/json"
 	"encoding/xml"
 	"flag"
 	"fmt"
-	"github.com/mingram/trail/kml"
+	"github.com/mingram/trail/clip"
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/mvt"
+	"github.com/mingram/trail/network"
 	"github.com/mingram/trail/osm"
-	"github.com/umahmood/haversine"
+	"github.com/mingram/trail/parks"
+	"github.com/mingram/trail/simplify"
+	"github.com/mingram/trail/units"
+	htmltemplate "html/template"
 	"io/ioutil"
 	"strings"
-	"sync"
+	"time"
 
 	//"github.com/AvraamMavridis/randomcolor"
 
@@ -29,9 +34,23 @@ type Properties struct {
 	Fill          string  `json:"fill"`
 	Name          string  `json:"name"`
 	FillOpacity   float64 `json:"fill-opacity"`
+	Description   string  `json:"description,omitempty"`
+	Park          string  `json:"park,omitempty"`
+	NameSource    string  `json:"name_source,omitempty"`
+	SyntheticName bool    `json:"synthetic_name,omitempty"`
+	Length        string  `json:"length,omitempty"`
+	Climb         string  `json:"climb,omitempty"`
+	Segment       string  `json:"segment,omitempty"`
+	// StrokeDasharray is an SVG dash pattern, set for trails with a
+	// condition reported
+	StrokeDasharray string `json:"stroke-dasharray,omitempty"`
+	Status          string `json:"status,omitempty"`
+	StatusNote      string `json:"status_note,omitempty"`
+	StatusUpdated   string `json:"status_updated,omitempty"`
 }
 type Feature struct {
 	Tipo       string     `json:"type"`
+	Id         string     `json:"id,omitempty"`
 	Geometry   Geometry   `json:"geometry"`
 	Properties Properties `json:"properties"`
 }
@@ -42,47 +61,182 @@ type GeoJson struct {
 }
 
 func main() {
+	var command string
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
 	osmFile := flag.String("file", "frederick-county.osm", "osm file")
 	activity := flag.String("activity", "any", "Type of activity")
-	fileType := flag.String("type", "kml", "Type of activity")
+	fileType := flag.String("type", "kml", "Output formats, comma separated: "+strings.Join(exporterNames(), ", "))
+	bbox := flag.String("bbox", "", "Only keep trails inside minLon,minLat,maxLon,maxLat")
+	clipFile := flag.String("clip", "", "Only keep trails inside the polygons of a GeoJSON or KML file")
+	parkName := flag.String("park", "", "Only keep trails inside the named park or protected area")
+	date := flag.String("date", "", "Only keep trails open on this day, YYYY-MM-DD or today, applying :conditional tags and opening_hours")
+	split := flag.Bool("split", false, "Split trails at every junction into junction to junction segments")
+	layout := flag.String("layout", "way", "One output file per "+strings.Join(layouts, ", "))
+	tileZoom := flag.Int("tilezoom", 12, "Zoom level of the tiles used by -layout tile")
+	simplifyTolerance := flag.Float64("simplify", 0, "Simplify exported lines to within this many metres, 0 to keep every node")
+	htmlOut := flag.String("html", "", "Also write a Leaflet preview page to this file")
+	gpkgOut := flag.String("gpkg", "", "Also write the trails and points of interest to this GeoPackage")
+	shpOut := flag.String("shp", "", "Also write a shapefile with this base name, without extension")
+	fgbOut := flag.String("fgb", "", "Also write the trails to this FlatGeobuf file")
+	parquetOut := flag.String("parquet", "", "Also write the trails to this GeoParquet file")
+	mvtOut := flag.String("mvt", "", "Also write vector tiles to this z/x/y directory or .mbtiles file")
+	minZoom := flag.Int("minzoom", 10, "Lowest zoom level for -mvt")
+	maxZoom := flag.Int("maxzoom", 14, "Highest zoom level for -mvt")
+	simplifyMethod := flag.String("simplifymethod", simplify.DouglasPeucker, "Simplification method, one of "+strings.Join(simplify.Methods, ", "))
+
+	unitSystem := flag.String("units", units.Metric, "Units descriptions use, "+strings.Join(units.Systems, " or "))
+	locale := flag.String("locale", "en", "How numbers are written in descriptions, one of "+strings.Join(units.Locales(), ", "))
+	decimals := flag.Int("decimals", -1, "Decimal places for distances, -1 to pick them from the distance")
+	description := flag.String("description", defaultDescription, "Go text/template for placemark descriptions, or @file to read it from a file")
+	conditionsFile := flag.String("conditions", "", "CSV of trail conditions with trail (name, way id or trail id), status, note and updated columns")
+	balloon := flag.String("balloon", "", "HTML html/template for KML descriptions and balloons: default for the built in one, or @file")
+	geodesic := flag.String("geodesic", "haversine", "How distances are measured, haversine or vincenty for the WGS84 ellipsoid")
+	addr := flag.String("addr", ":8080", "Address the serve command listens on")
+	store := flag.String("store", "", "Save the parsed extract here, for the update command to apply changes to")
+	oscFile := flag.String("osc", "", "OsmChange file (.osc or .osc.gz) for the update command")
+	reportFile := flag.String("report", "lint.csv", "Where the lint command writes its report, as JSON if it ends in .json and CSV otherwise")
+	reportKML := flag.String("reportkml", "lint.kml", "Where the lint command draws the ways with problems")
+	networkKML := flag.String("networkkml", "network.kml", "Where the lint command draws cut off trails and gaps")
+	statsOut := flag.String("statsout", "", "Also save the stats command's totals here, as CSV, JSON or Markdown (.md)")
+	gapMetres := flag.Float64("gap", 5, "Trail ends within this many metres of another trail are reported as gaps by lint")
+
+	flag.CommandLine.Parse(args)
+
+	validMethod := false
+	for _, m := range simplify.Methods {
+		validMethod = validMethod || m == *simplifyMethod
+	}
+	if !validMethod {
+		log.Fatal("unknown -simplifymethod " + *simplifyMethod + ", want one of " + strings.Join(simplify.Methods, ", "))
+	}
 
-	flag.Parse()
+	metric, ok := geo.Metrics[*geodesic]
+	if !ok {
+		log.Fatal("unknown -geodesic " + *geodesic + ", want haversine or vincenty")
+	}
 
-	xmlFile, err := os.Open(*osmFile)
-	// if we os.Open returns an error then handle it
+	presentation, err := units.New(*unitSystem, *locale, *decimals)
 	if err != nil {
-		fmt.Println(err)
+		log.Fatal(err)
+	}
+	descriptionTemplate, err := parseDescription(*description, presentation)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var balloonTemplate *htmltemplate.Template
+	if *balloon != "" {
+		balloonTemplate, err = parseBalloon(*balloon, presentation)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	fmt.Println("Successfully Opened " + *osmFile)
-	// defer the closing of our xmlFile so that we can parse it later on
-	defer xmlFile.Close()
+	var day time.Time
+	if *date == "today" {
+		day = time.Now()
+	} else if *date != "" {
+		day, err = time.Parse("2006-01-02", *date)
+		if err != nil {
+			log.Fatal("bad -date " + *date + ", want YYYY-MM-DD")
+		}
+	}
 
-	byteValue, _ := ioutil.ReadAll(xmlFile)
+	fileTypes, err := parseTypes(*fileType)
+	if err != nil {
+		log.Fatal(err)
+	}
+	validLayout := false
+	for _, l := range layouts {
+		validLayout = validLayout || l == *layout
+	}
+	if !validLayout {
+		log.Fatal("unknown -layout " + *layout + ", want one of " + strings.Join(layouts, ", "))
+	}
+	if *minZoom < 0 || *maxZoom > mvt.MaxZoom || *minZoom > *maxZoom {
+		log.Fatal(fmt.Sprintf("bad -minzoom %v and -maxzoom %v, want 0 <= minzoom <= maxzoom <= %v", *minZoom, *maxZoom, mvt.MaxZoom))
+	}
 
-	// we initialize our Users array
 	var osm openStreetMap.Osm
-	// we unmarshal our byteArray which contains our
-	// xmlFiles content into 'users' which we defined above
-	xml.Unmarshal(byteValue, &osm)
+	var changed map[string]bool
+	if command == "update" {
+		if *store == "" || *oscFile == "" {
+			log.Fatal("update needs -store and -osc")
+		}
+		var err error
+		osm, err = openStreetMap.LoadStore(*store)
+		if err == openStreetMap.ErrStoreVersion {
+			// the extract it was built from has missed every diff since, so
+			// it cannot simply be read again
+			log.Fatal(*store + " " + err.Error() + ", export the latest extract with -store to make a new one")
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		change, err := openStreetMap.ReadChange(*oscFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		changed = osm.Apply(change)
+		log.Print("Number of changed ways: " + fmt.Sprintf("%v", len(changed)))
+		if err := osm.SaveStore(*store); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		xmlFile, err := os.Open(*osmFile)
+		// if we os.Open returns an error then handle it
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		fmt.Println("Successfully Opened " + *osmFile)
+		// defer the closing of our xmlFile so that we can parse it later on
+		defer xmlFile.Close()
+
+		byteValue, _ := ioutil.ReadAll(xmlFile)
+
+		// we initialize our Users array
+		// we unmarshal our byteArray which contains our
+		// xmlFiles content into 'users' which we defined above
+		xml.Unmarshal(byteValue, &osm)
+
+		if *store != "" {
+			if err := osm.SaveStore(*store); err != nil {
+				log.Print(err)
+			}
+		}
+	}
 
-	KML := kml.NewKml(*activity+" Trails", "Trails")
-	KML.AddStyle("00FFFF", "FF00FFFF", 4)
-	KML.AddStyle("FFD700", "FFFFD700", 4)
-	KML.AddStyle("3333ff", "FF3333ff", 4)
-	KML.AddStyle("d699ff", "FFd699ff", 4)
-	KML.AddStyle("00FFFF", "FF00FFFF", 4)
-	KML.AddStyle("b3b3ff", "FFb3b3ff", 4)
-	KML.AddStyle("FF4DFF", "FFFF4DFF", 4)
-	KML.AddStyle("ff99cc", "FFff99cc", 4)
-	KML.AddStyle("ffff66", "FFffff66", 4)
+	// park outlines are built before clipping so boundaries crossing the
+	// clip area stay closed
+	areas := parks.FromOsm(osm)
+	log.Print("Number of parks: " + fmt.Sprintf("%v", len(areas)))
+
+	if *bbox != "" {
+		area, err := clip.ParseBBox(*bbox)
+		if err != nil {
+			log.Fatal(err)
+		}
+		area.Clip(&osm)
+	}
+	if *clipFile != "" {
+		area, err := clip.ReadFile(*clipFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		area.Clip(&osm)
+	}
 
 	var mtnBikes []openStreetMap.Way
 	var nodes [][]openStreetMap.Node
 	var ski openStreetMap.Ski
 	var mtnbike openStreetMap.Mtnbike
 	var foot openStreetMap.Foot
-	var wg sync.WaitGroup
+	// ways whose opening_hours shut them for the whole of -date
+	closed := 0
 
 	for _, way := range osm.Ways {
 		types := make(map[string]string)
@@ -91,7 +245,14 @@ func main() {
 			key, value := tag.Key, tag.Value
 			types[key] = value
 		}
-		way.Name = types["name"]
+		if !day.IsZero() {
+			openStreetMap.ApplyConditional(types, day)
+			if open, ok := openStreetMap.OpeningHours(types["opening_hours"], day); ok && !open {
+				closed++
+				continue
+			}
+		}
+		way.Name, way.NameSource = wayName(types)
 		if types["ski"] == "yes" || types["piste:type"] == "downhill" {
 			ski = openStreetMap.Ski{types["piste:difficulty"], "allowed", types["piste:type"]}
 			if strings.Index(*activity, "ski") != -1 || *activity == "any" {
@@ -140,21 +301,56 @@ func main() {
 		}
 
 	}
+	if !day.IsZero() {
+		log.Print("Number of ways closed on " + day.Format("2006-01-02") + ": " + fmt.Sprintf("%v", closed))
+	}
 	log.Print("Number of trails: " + fmt.Sprintf("%v", len(mtnBikes)))
 
+	// looking nodes up by id rather than scanning every node for every nd
+	// is what keeps a full county, and so every update, quick
+	index := make(map[string]openStreetMap.Node, len(osm.Nodes))
+	for _, node := range osm.Nodes {
+		index[node.Id] = node
+	}
+	var matched []openStreetMap.Way
 	for _, mtnBike := range mtnBikes {
 		var no []openStreetMap.Node
-		wg.Add(len(mtnBike.Nds))
 		for _, nd := range mtnBike.Nds {
-			messages := make(chan openStreetMap.Node)
-			go matchNode(nd, mtnBike, osm, messages, &wg)
-			newNode := <-messages
-			no = append(no, newNode)
-
+			if newNode, ok := matchNode(nd, mtnBike, index); ok {
+				no = append(no, newNode)
+			}
+		}
+		if len(no) > 0 {
+			matched = append(matched, mtnBike)
+			nodes = append(nodes, no)
+		}
+	}
+	mtnBikes = matched
+	nameTrails(mtnBikes, nodes, osm, metric)
+	for i, node := range nodes {
+		park := parks.Containing(areas, node)
+		mtnBikes[i].Park = park
+		for x := range node {
+			nodes[i][x].Park = park
 		}
-		nodes = append(nodes, no)
 	}
-	wg.Wait()
+	if *parkName != "" {
+		var parkWays []openStreetMap.Way
+		var parkNodes [][]openStreetMap.Node
+		for i, node := range nodes {
+			if strings.EqualFold(mtnBikes[i].Park, *parkName) {
+				parkWays = append(parkWays, mtnBikes[i])
+				parkNodes = append(parkNodes, node)
+			}
+		}
+		mtnBikes, nodes = parkWays, parkNodes
+		log.Print("Number of trails in " + *parkName + ": " + fmt.Sprintf("%v", len(mtnBikes)))
+	}
+	sortTrails(mtnBikes, nodes)
+	if *split {
+		mtnBikes, nodes = splitTrails(mtnBikes, nodes)
+		log.Print("Number of segments: " + fmt.Sprintf("%v", len(nodes)))
+	}
 	for _, mtnBike := range mtnBikes {
 		for _, mtnBike2 := range mtnBikes {
 			_, canBe := openStreetMap.CombineWays(mtnBike, mtnBike2)
@@ -163,107 +359,100 @@ func main() {
 			}
 		}
 	}
-	var features []Feature
-	geojson := GeoJson{}
-	geojson.Tipo = "FeatureCollection"
-
-	for _, node := range nodes {
-		if *fileType == "geojson" {
-			color, _ := GetColor(node[0])
-			var featuresLocal []Feature
-
-			geojsonLocal := GeoJson{}
-			geojsonLocal.Tipo = "FeatureCollection"
-			var coordinates [][]float64
-			for _, nd := range node {
-				coordinates = append(coordinates, []float64{nd.Lon, nd.Lat})
+	opts := exportOptions{
+		Activity:       *activity,
+		FileTypes:      fileTypes,
+		Layout:         *layout,
+		TileZoom:       *tileZoom,
+		MVT:            *mvtOut,
+		HTML:           *htmlOut,
+		MinZoom:        *minZoom,
+		MaxZoom:        *maxZoom,
+		Simplify:       *simplifyTolerance,
+		SimplifyMethod: *simplifyMethod,
+		Units:          presentation,
+		Description:    descriptionTemplate,
+		Balloon:        balloonTemplate,
+		Metric:         metric,
+	}
+	if opts.Simplify > 0 {
+		opts.Junctions = junctionNodes(nodes)
+	}
+	opts.Pieces = pieceWays(nodes)
+	if *conditionsFile != "" {
+		opts.Conditions, err = loadConditions(*conditionsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.unmatchedConditions(nodes)
+	}
 
+	switch command {
+	case "serve":
+		log.Fatal(serve(*addr, mtnBikes, nodes, opts))
+	case "lint":
+		components := network.Components(nodes, metric)
+		gaps := network.Gaps(nodes, *gapMetres, metric)
+		log.Print("Number of networks: " + fmt.Sprintf("%v", len(components)))
+		problems := opts.lint(mtnBikes, nodes, components, gaps)
+		log.Print("Number of problems: " + fmt.Sprintf("%v", len(problems)))
+		if err := writeLintReport(*reportFile, problems); err != nil {
+			log.Print(err)
+		}
+		if err := writeLintKML(*reportKML, nodes, problems); err != nil {
+			log.Print(err)
+		}
+		if err := writeNetworkKML(*networkKML, nodes, components, gaps); err != nil {
+			log.Print(err)
+		}
+	case "stats":
+		stats := opts.trailStats(nodes)
+		stats.WriteMarkdown(os.Stdout)
+		if *statsOut != "" {
+			if err := stats.SaveFile(*statsOut); err != nil {
+				log.Print(err)
 			}
-
-			geometry := Geometry{"LineString", coordinates}
-			feature := Feature{}
-			feature.Tipo = "Feature"
-			feature.Properties = Properties{Name: node[0].Name, Stroke: color, Fill: "#FFF", FillOpacity: .5, StrokeOpacity: 1.0, StrokeWidth: 2}
-			feature.Geometry = geometry
-			featuresLocal = append(featuresLocal, feature)
-			features = append(features, feature)
-			geojsonLocal.Features = featuresLocal
-			start, end := []string{fmt.Sprintf("%f", node[0].Lon), fmt.Sprintf("%f", node[0].Lat)}, []string{fmt.Sprintf("%f", node[len(node)-1].Lon), fmt.Sprintf("%f", node[len(node)-1].Lat)} // s == "123.456000"
-
-			name := strings.Replace(node[0].Name, "/", "-", -1)
-			os.MkdirAll("geojson/trails", os.ModePerm)
-			json, _ := json.Marshal(geojsonLocal)
-			err = ioutil.WriteFile("geojson/trails/"+name+"-Start-"+start[0]+","+start[1]+"End-"+end[0]+","+end[1]+".json", json, 0644)
-
-		} else if *fileType == "kml" {
-			KMLlocal := kml.NewKml(node[0].Name, "Trails")
-			KMLlocal.AddStyle("00FFFF", "FF00FFFF", 4)
-			KMLlocal.AddStyle("FFD700", "FFFFD700", 4)
-			KMLlocal.AddStyle("3333ff", "FF3333ff", 4)
-			KMLlocal.AddStyle("d699ff", "FFd699ff", 4)
-			KMLlocal.AddStyle("00FFFF", "FF00FFFF", 4)
-			KMLlocal.AddStyle("b3b3ff", "FFb3b3ff", 4)
-			KMLlocal.AddStyle("FF4DFF", "FFFF4DFF", 4)
-			KMLlocal.AddStyle("ff99cc", "FFff99cc", 4)
-			KMLlocal.AddStyle("ffff66", "FFffff66", 4)
-			var kmlCoordinates [][]float64
-			color, tipo := GetColor(node[0])
-			var totalDistance float64
-			var oldNode openStreetMap.Node
-			nahs := []openStreetMap.Node{}
-			for _, nd := range node {
-				nahs = append(nahs, nd)
-				kmlCoordinates = append(kmlCoordinates, []float64{nd.Lon, nd.Lat, 0.0})
-				if oldNode != (openStreetMap.Node{}) {
-					d := distance(nd.Lon, nd.Lat, oldNode.Lon, oldNode.Lat)
-					totalDistance += d
-				}
-				oldNode = nd
-
+		}
+	case "update":
+		opts.Changed = changed
+		opts.export(nodes)
+	case "":
+		opts.export(nodes)
+		if *gpkgOut != "" {
+			if err := opts.writeGeoPackage(*gpkgOut, nodes, osm); err != nil {
+				log.Print(err)
 			}
-			os.MkdirAll("kmls/trails", os.ModePerm)
-			start, end := []string{fmt.Sprintf("%f", node[0].Lon), fmt.Sprintf("%f", node[0].Lat)}, []string{fmt.Sprintf("%f", node[len(node)-1].Lon), fmt.Sprintf("%f", node[len(node)-1].Lat)} // s == "123.456000"
-
-			name := strings.Replace(node[0].Name, "/", "-", -1)
-			description := "Type: " + tipo + "\n" +
-				"Total Distance: " + fmt.Sprintf("%f", totalDistance) + " km"
-
-			KMLlocal.AddPlacemark(name, color, description, kmlCoordinates, nahs, "false")
-			KML.AddPlacemark(name, color, description, kmlCoordinates, nahs, "true")
-			KMLlocal.SaveFile("kmls/trails/" + name + "-Start-" + start[0] + "," + start[1] + "End-" + end[0] + "," + end[1] + ".kml")
 		}
-	}
-
-	//j :=  []byte(json)
-	//log.Print(string(j))
-
-	if *fileType == "kml" {
-		//KML.SortPlacemarkers()
-		//log.Print(len(KML.Placemarks))
-
-		KML.SaveFile("kmls/ALL_TRAILS.kml")
-	} else if *fileType == "geojson" {
-		geojson.Features = features
-		json, _ := json.Marshal(geojson)
-		err = ioutil.WriteFile("geojson/ALL_TRAILS.json", json, 0644)
+		if *shpOut != "" {
+			if err := opts.writeShapefile(*shpOut, mtnBikes, nodes); err != nil {
+				log.Print(err)
+			}
+		}
+		if *fgbOut != "" || *parquetOut != "" {
+			if err := opts.writeColumnar(*fgbOut, *parquetOut, nodes); err != nil {
+				log.Print(err)
+			}
+		}
+	default:
+		log.Fatal("unknown command " + command + ", want serve, update, lint, stats or none")
 	}
 
 }
 
-func matchNode(nd openStreetMap.Nd, way openStreetMap.Way, osm openStreetMap.Osm, c chan openStreetMap.Node, wg *sync.WaitGroup) {
-
-	for _, node := range osm.Nodes {
-		if nd.Ref == node.Id {
-			node.Name = way.Name
-			node.Wayid = way.Id
-			node.Ski = way.Ski
-			node.Mtnbike = way.Mtnbike
-			node.Foot = way.Foot
-			c <- node
-			wg.Done()
-			return
-		}
+func matchNode(nd openStreetMap.Nd, way openStreetMap.Way, index map[string]openStreetMap.Node) (openStreetMap.Node, bool) {
+	node, ok := index[nd.Ref]
+	if !ok {
+		return node, false
 	}
+	node.Name = way.Name
+	node.Wayid = way.Id
+	node.Ski = way.Ski
+	node.Mtnbike = way.Mtnbike
+	node.Foot = way.Foot
+	node.Park = way.Park
+	node.NameSource = way.NameSource
+	node.WayTags = way.Tags
+	return node, true
 }
 
 func sortTag(tag openStreetMap.Tag) (string, string) {
@@ -299,10 +488,3 @@ func GetColor(tipo openStreetMap.Node) (string, string) {
 	}
 
 }
-func distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
-	pos1 := haversine.Coord{Lat: lat1, Lon: lon1} //
-	pos2 := haversine.Coord{Lat: lat2, Lon: lon2} //
-	_, km := haversine.Distance(pos1, pos2)
-
-	return km
-}
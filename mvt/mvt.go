@@ -0,0 +1,354 @@
+package mvt
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+const (
+	Extent = 4096
+	// Buffer is how far, in tile units, lines carry on past the tile edge so
+	// renderers do not show seams between tiles.
+	Buffer = 64
+	// MaxZoom is the deepest zoom tiles can be made for, as far as any
+	// common renderer goes.
+	MaxZoom = 22
+)
+
+type Tile struct {
+	Z int
+	X int
+	Y int
+}
+
+// Feature is a line to be tiled. Properties may hold strings, float64s,
+// ints and bools.
+type Feature struct {
+	Id          uint64
+	Coordinates [][]float64
+	Properties  map[string]interface{}
+}
+
+// Build cuts the features into tiles for every zoom from minZoom to maxZoom
+// and encodes each tile as a single layer named layer.
+func Build(layer string, features []Feature, minZoom int, maxZoom int) map[Tile][]byte {
+	tiles := make(map[Tile][]byte)
+	for z := minZoom; z <= maxZoom; z++ {
+		layers := make(map[Tile]*layerEncoder)
+		for _, feature := range features {
+			for tile, lines := range cut(feature.Coordinates, z) {
+				enc, ok := layers[tile]
+				if !ok {
+					enc = newLayerEncoder(layer)
+					layers[tile] = enc
+				}
+				enc.addFeature(feature, lines)
+			}
+		}
+		for tile, enc := range layers {
+			tiles[tile] = encodeTile(enc.encode())
+		}
+	}
+	return tiles
+}
+
+// Sorted returns the tiles in z, x, y order.
+func Sorted(tiles map[Tile][]byte) []Tile {
+	var keys []Tile
+	for tile := range tiles {
+		keys = append(keys, tile)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Z != keys[j].Z {
+			return keys[i].Z < keys[j].Z
+		}
+		if keys[i].X != keys[j].X {
+			return keys[i].X < keys[j].X
+		}
+		return keys[i].Y < keys[j].Y
+	})
+	return keys
+}
+
+// project returns the position of lon/lat in tile units at zoom z.
+func project(lon float64, lat float64, z int) (float64, float64) {
+	n := math.Exp2(float64(z))
+	lat = math.Max(-85.0511, math.Min(85.0511, lat))
+	rad := lat * math.Pi / 180
+	x := (lon + 180) / 360 * n
+	y := (1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * n
+	return x, y
+}
+
+// cut clips a line to every tile it touches at zoom z, returning the pieces
+// in tile-local integer coordinates.
+func cut(coordinates [][]float64, z int) map[Tile][][][2]int {
+	pieces := make(map[Tile][][][2]int)
+	if len(coordinates) < 2 {
+		return pieces
+	}
+	points := make([][2]float64, len(coordinates))
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for i, c := range coordinates {
+		x, y := project(c[0], c[1], z)
+		points[i] = [2]float64{x, y}
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	buffer := float64(Buffer) / Extent
+	last := int(math.Exp2(float64(z))) - 1
+	for tx := clamp(int(math.Floor(minX-buffer)), last); tx <= clamp(int(math.Floor(maxX+buffer)), last); tx++ {
+		for ty := clamp(int(math.Floor(minY-buffer)), last); ty <= clamp(int(math.Floor(maxY+buffer)), last); ty++ {
+			local := make([][2]float64, len(points))
+			for i, p := range points {
+				local[i] = [2]float64{(p[0] - float64(tx)) * Extent, (p[1] - float64(ty)) * Extent}
+			}
+			if lines := clipLine(local, -Buffer, Extent+Buffer); len(lines) > 0 {
+				pieces[Tile{z, tx, ty}] = lines
+			}
+		}
+	}
+	return pieces
+}
+
+func clamp(v int, last int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > last {
+		return last
+	}
+	return v
+}
+
+// clipLine keeps the parts of a line inside the square lo..hi, splitting it
+// wherever it leaves and comes back, and rounds to whole tile units.
+func clipLine(points [][2]float64, lo float64, hi float64) [][][2]int {
+	var lines [][][2]int
+	var current [][2]int
+	add := func(p [2]float64) {
+		q := [2]int{int(math.Round(p[0])), int(math.Round(p[1]))}
+		if n := len(current); n == 0 || current[n-1] != q {
+			current = append(current, q)
+		}
+	}
+	flush := func() {
+		if len(current) >= 2 {
+			lines = append(lines, current)
+		}
+		current = nil
+	}
+	for i := 0; i+1 < len(points); i++ {
+		a, b, ok := clipSegment(points[i], points[i+1], lo, hi)
+		if !ok {
+			flush()
+			continue
+		}
+		if a != points[i] {
+			flush()
+		}
+		add(a)
+		add(b)
+		if b != points[i+1] {
+			flush()
+		}
+	}
+	flush()
+	return lines
+}
+
+// clipSegment is Liang-Barsky against an axis aligned square.
+func clipSegment(a [2]float64, b [2]float64, lo float64, hi float64) ([2]float64, [2]float64, bool) {
+	t0, t1 := 0.0, 1.0
+	d := [2]float64{b[0] - a[0], b[1] - a[1]}
+	for axis := 0; axis < 2; axis++ {
+		for _, edge := range []struct{ p, q float64 }{{-d[axis], a[axis] - lo}, {d[axis], hi - a[axis]}} {
+			if edge.p == 0 {
+				if edge.q < 0 {
+					return a, b, false
+				}
+				continue
+			}
+			t := edge.q / edge.p
+			if edge.p < 0 {
+				if t > t1 {
+					return a, b, false
+				}
+				t0 = math.Max(t0, t)
+			} else {
+				if t < t0 {
+					return a, b, false
+				}
+				t1 = math.Min(t1, t)
+			}
+		}
+	}
+	start, end := a, b
+	if t0 > 0 {
+		start = [2]float64{a[0] + t0*d[0], a[1] + t0*d[1]}
+	}
+	if t1 < 1 {
+		end = [2]float64{a[0] + t1*d[0], a[1] + t1*d[1]}
+	}
+	return start, end, true
+}
+
+// The encoders below write the vector tile protobuf schema by hand, it only
+// needs varints, fixed64 and length delimited fields.
+//
+//	Tile    { repeated Layer layers = 3; }
+//	Layer   { name = 1; features = 2; keys = 3; values = 4; extent = 5; version = 15; }
+//	Feature { id = 1; packed tags = 2; type = 3; packed geometry = 4; }
+//	Value   { string = 1; double = 3; sint = 6; bool = 7; }
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+
+	geomLineString = 2
+	cmdMoveTo      = 1
+	cmdLineTo      = 2
+)
+
+type layerEncoder struct {
+	name     string
+	keys     []string
+	keyIndex map[string]int
+	values   [][]byte
+	valIndex map[string]int
+	features [][]byte
+}
+
+func newLayerEncoder(name string) *layerEncoder {
+	return &layerEncoder{name: name, keyIndex: make(map[string]int), valIndex: make(map[string]int)}
+}
+
+func (enc *layerEncoder) key(k string) int {
+	if i, ok := enc.keyIndex[k]; ok {
+		return i
+	}
+	enc.keys = append(enc.keys, k)
+	enc.keyIndex[k] = len(enc.keys) - 1
+	return len(enc.keys) - 1
+}
+
+func (enc *layerEncoder) value(v interface{}) (int, bool) {
+	var b []byte
+	switch v := v.(type) {
+	case string:
+		b = appendBytes(b, 1, []byte(v))
+	case float64:
+		b = appendKey(b, 3, wireFixed64)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	case int:
+		b = appendKey(b, 6, wireVarint)
+		b = appendVarint(b, zigzag(int64(v)))
+	case bool:
+		b = appendKey(b, 7, wireVarint)
+		if v {
+			b = appendVarint(b, 1)
+		} else {
+			b = appendVarint(b, 0)
+		}
+	default:
+		return 0, false
+	}
+	if i, ok := enc.valIndex[string(b)]; ok {
+		return i, true
+	}
+	enc.values = append(enc.values, b)
+	enc.valIndex[string(b)] = len(enc.values) - 1
+	return len(enc.values) - 1, true
+}
+
+func (enc *layerEncoder) addFeature(feature Feature, lines [][][2]int) {
+	var names []string
+	for k := range feature.Properties {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var tags []uint64
+	for _, k := range names {
+		if v, ok := enc.value(feature.Properties[k]); ok {
+			tags = append(tags, uint64(enc.key(k)), uint64(v))
+		}
+	}
+
+	var geometry []uint64
+	var cx, cy int
+	for _, line := range lines {
+		geometry = append(geometry, command(cmdMoveTo, 1))
+		geometry = append(geometry, zigzag(int64(line[0][0]-cx)), zigzag(int64(line[0][1]-cy)))
+		cx, cy = line[0][0], line[0][1]
+		geometry = append(geometry, command(cmdLineTo, len(line)-1))
+		for _, p := range line[1:] {
+			geometry = append(geometry, zigzag(int64(p[0]-cx)), zigzag(int64(p[1]-cy)))
+			cx, cy = p[0], p[1]
+		}
+	}
+
+	var b []byte
+	if feature.Id != 0 {
+		b = appendKey(b, 1, wireVarint)
+		b = appendVarint(b, feature.Id)
+	}
+	b = appendPacked(b, 2, tags)
+	b = appendKey(b, 3, wireVarint)
+	b = appendVarint(b, geomLineString)
+	b = appendPacked(b, 4, geometry)
+	enc.features = append(enc.features, b)
+}
+
+func (enc *layerEncoder) encode() []byte {
+	var b []byte
+	b = appendKey(b, 15, wireVarint)
+	b = appendVarint(b, 2)
+	b = appendBytes(b, 1, []byte(enc.name))
+	for _, f := range enc.features {
+		b = appendBytes(b, 2, f)
+	}
+	for _, k := range enc.keys {
+		b = appendBytes(b, 3, []byte(k))
+	}
+	for _, v := range enc.values {
+		b = appendBytes(b, 4, v)
+	}
+	b = appendKey(b, 5, wireVarint)
+	b = appendVarint(b, Extent)
+	return b
+}
+
+func encodeTile(layer []byte) []byte {
+	return appendBytes(nil, 3, layer)
+}
+
+func command(id int, count int) uint64 {
+	return uint64(id&0x7 | count<<3)
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+func appendKey(b []byte, field int, wire int) []byte {
+	return appendVarint(b, uint64(field<<3|wire))
+}
+
+func appendBytes(b []byte, field int, data []byte) []byte {
+	b = appendKey(b, field, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendPacked(b []byte, field int, values []uint64) []byte {
+	var packed []byte
+	for _, v := range values {
+		packed = appendVarint(packed, v)
+	}
+	return appendBytes(b, field, packed)
+}
@@ -0,0 +1,239 @@
+package mvt
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// field is one protobuf field, its varint or fixed64 value in v and its
+// length delimited bytes in b.
+type field struct {
+	num  int
+	wire int
+	v    uint64
+	b    []byte
+}
+
+func fields(t *testing.T, b []byte) []field {
+	t.Helper()
+	var out []field
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		f := field{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.v, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireFixed64:
+			f.v = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			f.b = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", f.wire)
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func packed(b []byte) []uint64 {
+	var values []uint64
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values
+}
+
+func unzigzag(v uint64) int {
+	return int(int64(v>>1) ^ -int64(v&1))
+}
+
+type decodedFeature struct {
+	id         uint64
+	properties map[string]interface{}
+	lines      [][][2]int
+}
+
+type decodedLayer struct {
+	name     string
+	version  uint64
+	extent   uint64
+	features []decodedFeature
+}
+
+// decode reads back a tile of one layer.
+func decode(t *testing.T, tile []byte) decodedLayer {
+	t.Helper()
+	tileFields := fields(t, tile)
+	if len(tileFields) != 1 || tileFields[0].num != 3 {
+		t.Fatalf("tile fields = %v, want one layer", tileFields)
+	}
+	var layer decodedLayer
+	var keys []string
+	var values []interface{}
+	var raw [][]field
+	for _, f := range fields(t, tileFields[0].b) {
+		switch f.num {
+		case 1:
+			layer.name = string(f.b)
+		case 2:
+			raw = append(raw, fields(t, f.b))
+		case 3:
+			keys = append(keys, string(f.b))
+		case 4:
+			v := fields(t, f.b)[0]
+			switch v.num {
+			case 1:
+				values = append(values, string(v.b))
+			case 3:
+				values = append(values, math.Float64frombits(v.v))
+			case 6:
+				values = append(values, unzigzag(v.v))
+			case 7:
+				values = append(values, v.v == 1)
+			}
+		case 5:
+			layer.extent = f.v
+		case 15:
+			layer.version = f.v
+		}
+	}
+	for _, featureFields := range raw {
+		feature := decodedFeature{properties: make(map[string]interface{})}
+		for _, f := range featureFields {
+			switch f.num {
+			case 1:
+				feature.id = f.v
+			case 2:
+				tags := packed(f.b)
+				for i := 0; i+1 < len(tags); i += 2 {
+					feature.properties[keys[tags[i]]] = values[tags[i+1]]
+				}
+			case 3:
+				if f.v != geomLineString {
+					t.Errorf("geometry type = %d, want LineString", f.v)
+				}
+			case 4:
+				geometry := packed(f.b)
+				var x, y int
+				for len(geometry) > 0 {
+					cmd, count := int(geometry[0]&7), int(geometry[0]>>3)
+					geometry = geometry[1:]
+					if cmd == cmdMoveTo {
+						feature.lines = append(feature.lines, nil)
+					}
+					for i := 0; i < count; i++ {
+						x += unzigzag(geometry[0])
+						y += unzigzag(geometry[1])
+						geometry = geometry[2:]
+						line := &feature.lines[len(feature.lines)-1]
+						*line = append(*line, [2]int{x, y})
+					}
+				}
+			}
+		}
+		layer.features = append(layer.features, feature)
+	}
+	return layer
+}
+
+func TestBuild(t *testing.T) {
+	features := []Feature{{
+		Id:          42,
+		Coordinates: [][]float64{{-10, 0}, {10, 0}},
+		Properties:  map[string]interface{}{"name": "Blue", "length": 1.5, "count": 3, "open": true, "skipped": []int{1}},
+	}}
+	tiles := Build("trails", features, 0, 1)
+	want := []Tile{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {1, 1, 0}, {1, 1, 1}}
+	if got := Sorted(tiles); !reflect.DeepEqual(got, want) {
+		t.Fatalf("tiles = %v, want %v", got, want)
+	}
+
+	layer := decode(t, tiles[Tile{0, 0, 0}])
+	if layer.name != "trails" || layer.version != 2 || layer.extent != Extent {
+		t.Errorf("layer %q version %d extent %d", layer.name, layer.version, layer.extent)
+	}
+	if len(layer.features) != 1 {
+		t.Fatalf("%d features, want 1", len(layer.features))
+	}
+	feature := layer.features[0]
+	if feature.id != 42 {
+		t.Errorf("id = %d, want 42", feature.id)
+	}
+	wantProperties := map[string]interface{}{"name": "Blue", "length": 1.5, "count": 3, "open": true}
+	if !reflect.DeepEqual(feature.properties, wantProperties) {
+		t.Errorf("properties = %v, want %v", feature.properties, wantProperties)
+	}
+	// 170/360 and 190/360 of the way across, on the equator
+	if want := [][][2]int{{{1934, 2048}, {2162, 2048}}}; !reflect.DeepEqual(feature.lines, want) {
+		t.Errorf("z0 lines = %v, want %v", feature.lines, want)
+	}
+
+	// at z1 the equator is the edge between rows, so the line is in both,
+	// and it runs into the buffer of the tile on either side of lon 0
+	for tile, want := range map[Tile][][2]int{
+		{1, 0, 0}: {{3868, 4096}, {4160, 4096}},
+		{1, 1, 0}: {{-64, 4096}, {228, 4096}},
+		{1, 0, 1}: {{3868, 0}, {4160, 0}},
+		{1, 1, 1}: {{-64, 0}, {228, 0}},
+	} {
+		lines := decode(t, tiles[tile]).features[0].lines
+		if !reflect.DeepEqual(lines, [][][2]int{want}) {
+			t.Errorf("%v lines = %v, want %v", tile, lines, want)
+		}
+	}
+}
+
+func TestClipLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		points [][2]float64
+		want   [][][2]int
+	}{
+		{"inside", [][2]float64{{10, 10}, {100, 100}, {200, 50}}, [][][2]int{{{10, 10}, {100, 100}, {200, 50}}}},
+		{"outside", [][2]float64{{-200, -200}, {-100, -300}}, nil},
+		{"enters", [][2]float64{{-1000, 50}, {100, 50}}, [][][2]int{{{-64, 50}, {100, 50}}}},
+		{"leaves", [][2]float64{{100, 50}, {100, 9000}}, [][][2]int{{{100, 50}, {100, 4160}}}},
+		{"crosses", [][2]float64{{-1000, 50}, {9000, 50}}, [][][2]int{{{-64, 50}, {4160, 50}}}},
+		{"leaves and comes back", [][2]float64{{0, 100}, {5000, 100}, {5000, 200}, {0, 200}},
+			[][][2]int{{{0, 100}, {4160, 100}}, {{4160, 200}, {0, 200}}}},
+		{"along the edge", [][2]float64{{4160, 0}, {4160, 100}}, [][][2]int{{{4160, 0}, {4160, 100}}}},
+		{"just past the edge", [][2]float64{{4160.5, 0}, {4160.5, 100}}, nil},
+		{"cuts the corner", [][2]float64{{-100, 0}, {0, -100}}, [][][2]int{{{-64, -36}, {-36, -64}}}},
+		{"misses the corner", [][2]float64{{-100, -40}, {-40, -100}}, nil},
+		{"shorter than a unit", [][2]float64{{10, 10}, {10.2, 10.3}}, nil},
+		{"repeated point", [][2]float64{{10, 10}, {10, 10}, {20, 10}}, [][][2]int{{{10, 10}, {20, 10}}}},
+	}
+	for _, test := range tests {
+		got := clipLine(test.points, -Buffer, Extent+Buffer)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: clipLine = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCut(t *testing.T) {
+	if pieces := cut([][]float64{{0, 0}}, 3); len(pieces) != 0 {
+		t.Errorf("a single point cut into %v", pieces)
+	}
+	// the buffer past the antimeridian is not a tile
+	pieces := cut([][]float64{{179.9, 10}, {179.99, 10}}, 1)
+	for tile := range pieces {
+		if tile.X != 1 || tile.Y != 0 {
+			t.Errorf("line at the antimeridian is in %v", tile)
+		}
+	}
+	// the poles are clamped to the edge of the map rather than lost
+	pieces = cut([][]float64{{0, 89}, {1, 89.5}}, 0)
+	if lines := pieces[Tile{0, 0, 0}]; len(lines) != 1 || lines[0][0][1] != 0 {
+		t.Errorf("polar line = %v, want one line along y 0", lines)
+	}
+}
@@ -0,0 +1,108 @@
+package mvt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// WriteDir saves the tiles as dir/z/x/y.pbf, uncompressed.
+func WriteDir(dir string, tiles map[Tile][]byte) error {
+	for _, tile := range Sorted(tiles) {
+		path := filepath.Join(dir, fmt.Sprintf("%d/%d/%d.pbf", tile.Z, tile.X, tile.Y))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, tiles[tile], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metadata describes a tileset for the MBTiles metadata table.
+type Metadata struct {
+	Name    string
+	Layer   string
+	Fields  map[string]string
+	MinZoom int
+	MaxZoom int
+	// Bounds is minLon, minLat, maxLon, maxLat
+	Bounds [4]float64
+}
+
+// WriteMBTiles saves the tiles into a new MBTiles SQLite file, gzipped as
+// the spec asks for vector tiles. Any existing file is replaced.
+func WriteMBTiles(file string, tiles map[Tile][]byte, meta Metadata) error {
+	os.Remove(file)
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE metadata (name TEXT, value TEXT);
+		CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB);
+		CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row);`)
+	if err != nil {
+		return err
+	}
+
+	layers, _ := json.Marshal(map[string]interface{}{
+		"vector_layers": []map[string]interface{}{{
+			"id":      meta.Layer,
+			"fields":  meta.Fields,
+			"minzoom": meta.MinZoom,
+			"maxzoom": meta.MaxZoom,
+		}},
+	})
+	b := meta.Bounds
+	values := [][2]string{
+		{"name", meta.Name},
+		{"format", "pbf"},
+		{"type", "overlay"},
+		{"version", "1"},
+		{"minzoom", fmt.Sprintf("%d", meta.MinZoom)},
+		{"maxzoom", fmt.Sprintf("%d", meta.MaxZoom)},
+		{"bounds", fmt.Sprintf("%f,%f,%f,%f", b[0], b[1], b[2], b[3])},
+		{"center", fmt.Sprintf("%f,%f,%d", (b[0]+b[2])/2, (b[1]+b[3])/2, meta.MinZoom)},
+		{"json", string(layers)},
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if _, err := tx.Exec("INSERT INTO metadata (name, value) VALUES (?, ?)", v[0], v[1]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	insert, err := tx.Prepare("INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+	for _, tile := range Sorted(tiles) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(tiles[tile])
+		zw.Close()
+		// MBTiles rows count up from the south like TMS
+		row := 1<<uint(tile.Z) - 1 - tile.Y
+		if _, err := insert.Exec(tile.Z, tile.X, row, buf.Bytes()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/osm"
+	"math"
+)
+
+// Where a trail's name came from when it is not one of the way's own name
+// tags. These names are synthetic and flagged as such in the output.
+const (
+	NameRelation = "relation"
+	NameNearby   = "nearby"
+)
+
+var nameTags = []string{"name", "ref", "official_name", "alt_name"}
+
+// nearbyMetres is how close a named trail has to come to an end of an
+// unnamed one for the unnamed one to be called a connector to it.
+const nearbyMetres = 100
+
+// wayName picks the first name-like tag a way has.
+func wayName(types map[string]string) (string, string) {
+	for _, key := range nameTags {
+		if types[key] != "" {
+			return types[key], key
+		}
+	}
+	return "", ""
+}
+
+func syntheticName(source string) bool {
+	return source == NameRelation || source == NameNearby
+}
+
+// relationNames maps way ids to the name of a relation they belong to, with
+// route relations winning over anything else.
+func relationNames(osm openStreetMap.Osm) map[string]string {
+	names := make(map[string]string)
+	routes := make(map[string]bool)
+	for _, relation := range osm.Relations {
+		types := openStreetMap.TagMap(relation.Tags)
+		name, _ := wayName(types)
+		if name == "" {
+			continue
+		}
+		route := types["type"] == "route"
+		for _, member := range relation.Members {
+			if member.Type != "way" || routes[member.Ref] {
+				continue
+			}
+			if names[member.Ref] == "" || route {
+				names[member.Ref] = name
+				routes[member.Ref] = route
+			}
+		}
+	}
+	return names
+}
+
+// nameTrails fills in the trails that still have no name, first from a
+// relation they are part of and then from the closest named trail, as
+// metric measures it.
+func nameTrails(ways []openStreetMap.Way, nodes [][]openStreetMap.Node, osm openStreetMap.Osm, metric geo.Metric) {
+	relations := relationNames(osm)
+	for i, way := range ways {
+		if way.Name == "" && relations[way.Id] != "" {
+			setName(ways, nodes, i, relations[way.Id], NameRelation)
+		}
+	}
+
+	var named []int
+	for i, way := range ways {
+		if way.Name != "" {
+			named = append(named, i)
+		}
+	}
+	for i, way := range ways {
+		if way.Name != "" {
+			continue
+		}
+		name := "Unnamed trail"
+		if nearest := nearestTrail(nodes[i], nodes, named, metric); nearest != -1 {
+			name = "Unnamed connector near " + ways[nearest].Name
+		}
+		setName(ways, nodes, i, name, NameNearby)
+	}
+}
+
+func setName(ways []openStreetMap.Way, nodes [][]openStreetMap.Node, i int, name string, source string) {
+	ways[i].Name = name
+	ways[i].NameSource = source
+	for x := range nodes[i] {
+		nodes[i][x].Name = name
+		nodes[i][x].NameSource = source
+	}
+}
+
+// nearestTrail finds the candidate with a node closest to either end of the
+// trail. Only the ends are checked since that is where connectors join. It
+// is -1 if no candidate comes within nearbyMetres.
+func nearestTrail(trail []openStreetMap.Node, nodes [][]openStreetMap.Node, candidates []int, metric geo.Metric) int {
+	if len(trail) == 0 {
+		return -1
+	}
+	ends := []openStreetMap.Node{trail[0], trail[len(trail)-1]}
+	best, bestDistance := -1, math.Inf(1)
+	for _, i := range candidates {
+		for _, node := range nodes[i] {
+			for _, end := range ends {
+				d := metric(geo.Point{Lon: node.Lon, Lat: node.Lat}, geo.Point{Lon: end.Lon, Lat: end.Lat})
+				if d < bestDistance && d*1000 <= nearbyMetres {
+					best, bestDistance = i, d
+				}
+			}
+		}
+	}
+	return best
+}
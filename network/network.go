@@ -0,0 +1,168 @@
+package network
+
+import (
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/osm"
+	"math"
+	"sort"
+)
+
+// Components groups the trails that are joined, directly or through other
+// trails, by a shared node. The longest network, as metric measures it,
+// comes first; each component lists its trail indexes in order.
+func Components(trails [][]openStreetMap.Node, metric geo.Metric) [][]int {
+	parent := make([]int, len(trails))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	owner := make(map[string]int)
+	for i, trail := range trails {
+		for _, node := range trail {
+			if other, ok := owner[node.Id]; ok {
+				a, b := find(i), find(other)
+				if a > b {
+					a, b = b, a
+				}
+				parent[b] = a
+			} else {
+				owner[node.Id] = i
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range trails {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+	var components [][]int
+	var lengths []float64
+	for _, root := range roots {
+		km := 0.0
+		for _, i := range groups[root] {
+			km += length(trails[i], metric)
+		}
+		components = append(components, groups[root])
+		lengths = append(lengths, km)
+	}
+	order := make([]int, len(components))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return lengths[order[i]] > lengths[order[j]] })
+	sorted := make([][]int, len(components))
+	for i, c := range order {
+		sorted[i] = components[c]
+	}
+	return sorted
+}
+
+func point(node openStreetMap.Node) geo.Point {
+	return geo.Point{Lon: node.Lon, Lat: node.Lat}
+}
+
+func length(trail []openStreetMap.Node, metric geo.Metric) float64 {
+	points := make([]geo.Point, len(trail))
+	for i, node := range trail {
+		points[i] = point(node)
+	}
+	return metric.Length(points)
+}
+
+// Gap is a loose trail end that stops just short of another trail, most
+// likely a junction that was never joined up when it was drawn.
+type Gap struct {
+	// Trail and End are the trail index and the end node left dangling
+	Trail int
+	End   openStreetMap.Node
+	// Other is the trail it nearly meets and Point, [lon, lat], the closest
+	// spot on it
+	Other  int
+	Point  []float64
+	Metres float64
+}
+
+// Gaps finds the trail ends that share their node with no other trail but
+// come within maxMetres of one, measured with metric.
+func Gaps(trails [][]openStreetMap.Node, maxMetres float64, metric geo.Metric) []Gap {
+	uses := make(map[string]int)
+	for _, trail := range trails {
+		for _, node := range trail {
+			uses[node.Id]++
+		}
+	}
+
+	// degrees of latitude covering maxMetres
+	pad := maxMetres / 1000 / geo.EarthRadiusKm * 180 / math.Pi
+	boxes := make([][4]float64, len(trails))
+	for i, trail := range trails {
+		box := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		for _, node := range trail {
+			box[0], box[1] = math.Min(box[0], node.Lon), math.Min(box[1], node.Lat)
+			box[2], box[3] = math.Max(box[2], node.Lon), math.Max(box[3], node.Lat)
+		}
+		// longitude degrees shrink toward the poles, pad them more
+		lonPad := pad / math.Max(math.Cos((box[1]+box[3])/2*math.Pi/180), 0.01)
+		boxes[i] = [4]float64{box[0] - lonPad, box[1] - pad, box[2] + lonPad, box[3] + pad}
+	}
+
+	var gaps []Gap
+	for i, trail := range trails {
+		if len(trail) < 2 {
+			continue
+		}
+		ends := []openStreetMap.Node{trail[0]}
+		if trail[len(trail)-1].Id != trail[0].Id {
+			ends = append(ends, trail[len(trail)-1])
+		}
+		for _, end := range ends {
+			if uses[end.Id] > 1 {
+				continue
+			}
+			best := Gap{Metres: math.Inf(1)}
+			for j, other := range trails {
+				box := boxes[j]
+				if j == i || end.Lon < box[0] || end.Lon > box[2] || end.Lat < box[1] || end.Lat > box[3] {
+					continue
+				}
+				for x := 1; x < len(other); x++ {
+					point, metres := closest(end, other[x-1], other[x], metric)
+					if metres < best.Metres {
+						best = Gap{Trail: i, End: end, Other: j, Point: point, Metres: metres}
+					}
+				}
+			}
+			if best.Metres > 0 && best.Metres <= maxMetres {
+				gaps = append(gaps, best)
+			}
+		}
+	}
+	return gaps
+}
+
+// closest returns the point on segment a-b nearest to p and how far away it
+// is in metres, finding it in a flat projection around p.
+func closest(p openStreetMap.Node, a openStreetMap.Node, b openStreetMap.Node, metric geo.Metric) ([]float64, float64) {
+	origin := point(p)
+	ax, ay := geo.Flat(origin, point(a))
+	bx, by := geo.Flat(origin, point(b))
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if length := dx*dx + dy*dy; length > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/length))
+	}
+	nearest := geo.Unflat(origin, ax+t*dx, ay+t*dy)
+	return []float64{nearest.Lon, nearest.Lat}, metric(origin, nearest) * 1000
+}
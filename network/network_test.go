@@ -0,0 +1,102 @@
+package network
+
+import (
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/osm"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// trail runs through the named nodes, each given as id and [lon, lat]
+// offsets in metres east and north of 39.52 N, 77.45 W.
+func trail(nodes ...interface{}) []openStreetMap.Node {
+	origin := geo.Point{Lon: -77.45, Lat: 39.52}
+	var trail []openStreetMap.Node
+	for i := 0; i < len(nodes); i += 2 {
+		at := nodes[i+1].([2]float64)
+		p := geo.Unflat(origin, at[0], at[1])
+		trail = append(trail, openStreetMap.Node{Id: nodes[i].(string), Lon: p.Lon, Lat: p.Lat})
+	}
+	return trail
+}
+
+func TestComponents(t *testing.T) {
+	trails := [][]openStreetMap.Node{
+		trail("a", [2]float64{0, 0}, "b", [2]float64{100, 0}),
+		trail("c", [2]float64{0, 500}, "d", [2]float64{1000, 500}),
+		trail("b", [2]float64{100, 0}, "e", [2]float64{200, 0}),
+		trail("f", [2]float64{0, 900}, "g", [2]float64{10, 900}, "h", [2]float64{20, 900}, "i", [2]float64{30, 900}, "j", [2]float64{40, 900}),
+		trail("e", [2]float64{200, 0}, "k", [2]float64{300, 0}, "b", [2]float64{100, 0}),
+	}
+	tests := []struct {
+		name   string
+		metric geo.Metric
+		want   [][]int
+	}{
+		// the lone 1 km trail is longer than the 400 m network
+		{"haversine", geo.Haversine, [][]int{{1}, {0, 2, 4}, {3}}},
+		// counting legs, the short trail of four legs is the longest
+		{"legs", func(geo.Point, geo.Point) float64 { return 1 }, [][]int{{0, 2, 4}, {3}, {1}}},
+	}
+	for _, test := range tests {
+		if got := Components(trails, test.metric); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Components by %s = %v, want %v", test.name, got, test.want)
+		}
+	}
+	if got := Components(nil, geo.Haversine); len(got) != 0 {
+		t.Errorf("Components(nil) = %v, want none", got)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	trails := [][]openStreetMap.Node{
+		// the main trail, east along the origin
+		trail("a", [2]float64{0, 0}, "b", [2]float64{100, 0}, "c", [2]float64{200, 0}),
+		// stops 8 m north of the main trail's middle
+		trail("d", [2]float64{50, 8}, "e", [2]float64{50, 100}),
+		// joins the main trail at b, its far end is nowhere near
+		trail("b", [2]float64{100, 0}, "f", [2]float64{100, -100}),
+		// ends 30 m past the main trail's end, too far
+		trail("g", [2]float64{230, 0}, "h", [2]float64{300, 0}),
+		// a loop 5 m from the spur has no loose end to leave a gap
+		trail("i", [2]float64{105, -50}, "j", [2]float64{150, -50}, "k", [2]float64{150, -80}, "i", [2]float64{105, -50}),
+	}
+	gaps := Gaps(trails, 20, geo.Haversine)
+	want := []struct {
+		trail int
+		end   string
+		other int
+		east  float64
+		north float64
+	}{
+		{1, "d", 0, 50, 0},
+	}
+	if len(gaps) != len(want) {
+		t.Fatalf("Gaps = %v, want %d", gaps, len(want))
+	}
+	origin := geo.Point{Lon: -77.45, Lat: 39.52}
+	for i, w := range want {
+		gap := gaps[i]
+		if gap.Trail != w.trail || gap.End.Id != w.end || gap.Other != w.other {
+			t.Errorf("gap %d = trail %d end %s to %d, want trail %d end %s to %d", i, gap.Trail, gap.End.Id, gap.Other, w.trail, w.end, w.other)
+		}
+		east, north := geo.Flat(origin, geo.Point{Lon: gap.Point[0], Lat: gap.Point[1]})
+		if math.Abs(east-w.east) > 0.01 || math.Abs(north-w.north) > 0.01 {
+			t.Errorf("gap %d closest point = %.2f m east, %.2f m north, want %g, %g", i, east, north, w.east, w.north)
+		}
+		endEast, endNorth := geo.Flat(origin, geo.Point{Lon: gap.End.Lon, Lat: gap.End.Lat})
+		if metres := math.Hypot(endEast-w.east, endNorth-w.north); math.Abs(gap.Metres-metres) > 0.01 {
+			t.Errorf("gap %d = %.2f m, want %.2f", i, gap.Metres, metres)
+		}
+	}
+
+	// the gap follows the metric it is given
+	double := func(a geo.Point, b geo.Point) float64 { return 2 * geo.Haversine(a, b) }
+	if gaps := Gaps(trails, 12, double); len(gaps) != 0 {
+		t.Errorf("Gaps within 12 m by double distance = %v, want none", gaps)
+	}
+	if gaps := Gaps(trails, 20, double); len(gaps) != 1 || math.Abs(gaps[0].Metres-16) > 0.01 {
+		t.Errorf("Gaps within 20 m by double distance = %v, want one of 16 m", gaps)
+	}
+}
@@ -0,0 +1,204 @@
+package openStreetMap
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Change is an OsmChange (.osc) document. Each block holds full copies of
+// the nodes, ways and relations it touches.
+type Change struct {
+	XMLName xml.Name `xml:"osmChange"`
+	Create  []Osm    `xml:"create"`
+	Modify  []Osm    `xml:"modify"`
+	Delete  []Osm    `xml:"delete"`
+}
+
+// ReadChange loads an .osc file, gunzipping it first when it ends in .gz.
+func ReadChange(file string) (Change, error) {
+	var change Change
+	f, err := os.Open(file)
+	if err != nil {
+		return change, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return change, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	err = xml.NewDecoder(r).Decode(&change)
+	return change, err
+}
+
+// Apply replays a change onto osm and returns the ids of the ways whose
+// geometry or tags may have changed: ways that were created, modified or
+// deleted, ways that use a node that was, and the member ways of any
+// relation that was, before and after the change, since relations carry
+// route and park tags onto their ways.
+func (osm *Osm) Apply(change Change) map[string]bool {
+	nodes := make(map[string]int, len(osm.Nodes))
+	for i, node := range osm.Nodes {
+		nodes[node.Id] = i
+	}
+	ways := make(map[string]int, len(osm.Ways))
+	for i, way := range osm.Ways {
+		ways[way.Id] = i
+	}
+	relations := make(map[string]int, len(osm.Relations))
+	for i, relation := range osm.Relations {
+		relations[relation.Id] = i
+	}
+
+	changedNodes := make(map[string]bool)
+	changedWays := make(map[string]bool)
+	deletedNodes := make(map[string]bool)
+	deletedWays := make(map[string]bool)
+	deletedRelations := make(map[string]bool)
+	memberWays := func(relation Relation) {
+		for _, member := range relation.Members {
+			if member.Type == "way" {
+				changedWays[member.Ref] = true
+			}
+		}
+	}
+
+	for _, block := range append(change.Create, change.Modify...) {
+		for _, node := range block.Nodes {
+			changedNodes[node.Id] = true
+			if i, ok := nodes[node.Id]; ok {
+				osm.Nodes[i] = node
+			} else {
+				nodes[node.Id] = len(osm.Nodes)
+				osm.Nodes = append(osm.Nodes, node)
+			}
+		}
+		for _, way := range block.Ways {
+			changedWays[way.Id] = true
+			if i, ok := ways[way.Id]; ok {
+				osm.Ways[i] = way
+			} else {
+				ways[way.Id] = len(osm.Ways)
+				osm.Ways = append(osm.Ways, way)
+			}
+		}
+		for _, relation := range block.Relations {
+			memberWays(relation)
+			if i, ok := relations[relation.Id]; ok {
+				memberWays(osm.Relations[i])
+				osm.Relations[i] = relation
+			} else {
+				relations[relation.Id] = len(osm.Relations)
+				osm.Relations = append(osm.Relations, relation)
+			}
+		}
+	}
+	for _, block := range change.Delete {
+		for _, node := range block.Nodes {
+			changedNodes[node.Id] = true
+			deletedNodes[node.Id] = true
+		}
+		for _, way := range block.Ways {
+			changedWays[way.Id] = true
+			deletedWays[way.Id] = true
+		}
+		for _, relation := range block.Relations {
+			deletedRelations[relation.Id] = true
+			if i, ok := relations[relation.Id]; ok {
+				memberWays(osm.Relations[i])
+			}
+		}
+	}
+
+	var keptNodes []Node
+	for _, node := range osm.Nodes {
+		if !deletedNodes[node.Id] {
+			keptNodes = append(keptNodes, node)
+		}
+	}
+	var keptWays []Way
+	for _, way := range osm.Ways {
+		for _, nd := range way.Nds {
+			if changedNodes[nd.Ref] {
+				changedWays[way.Id] = true
+				break
+			}
+		}
+		if !deletedWays[way.Id] {
+			keptWays = append(keptWays, way)
+		}
+	}
+	var keptRelations []Relation
+	for _, relation := range osm.Relations {
+		if !deletedRelations[relation.Id] {
+			keptRelations = append(keptRelations, relation)
+		}
+	}
+	osm.Nodes, osm.Ways, osm.Relations = keptNodes, keptWays, keptRelations
+	return changedWays
+}
+
+// storeVersion is written at the start of a store and bumped whenever the
+// types saved in it change, as when Node.Tags became a slice.
+const storeVersion = 2
+
+// ErrStoreVersion is returned by LoadStore for a store saved by another
+// version, which has to be rebuilt from the extract.
+var ErrStoreVersion = errors.New("store was saved by another version")
+
+// LoadStore reads back an extract saved with SaveStore, which is much
+// quicker than parsing the original XML again.
+func LoadStore(file string) (Osm, error) {
+	var osm Osm
+	f, err := os.Open(file)
+	if err != nil {
+		return osm, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return osm, err
+	}
+	defer zr.Close()
+	dec := gob.NewDecoder(zr)
+	// stores from before the version was written start with the Osm
+	// itself, which does not decode as an int
+	var version int
+	if err := dec.Decode(&version); err != nil || version != storeVersion {
+		return osm, ErrStoreVersion
+	}
+	err = dec.Decode(&osm)
+	return osm, err
+}
+
+func (osm Osm) SaveStore(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	enc := gob.NewEncoder(zw)
+	if err := enc.Encode(storeVersion); err != nil {
+		f.Close()
+		return err
+	}
+	if err := enc.Encode(osm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,378 @@
+package openStreetMap
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conditional restrictions (key:conditional=value @ condition) and
+// opening_hours are only worked out to the day: a trail counts as open on a
+// day if it is open at any time during it. Anything this does not
+// understand, like wet or weight conditions, public holidays or week
+// numbers, is left out rather than guessed at.
+
+var monthNames = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"mo": time.Monday, "tu": time.Tuesday, "we": time.Wednesday, "th": time.Thursday,
+	"fr": time.Friday, "sa": time.Saturday, "su": time.Sunday,
+}
+
+// restrictive values shut a trail to the activity, so a condition that
+// only holds for part of the day does not close the whole day.
+var restrictive = map[string]bool{"no": true, "private": true, "dismount": true}
+
+var tokenPattern = regexp.MustCompile(`"[^"]*"|\d{1,2}:\d{2}|\d+|[A-Za-z]+|[-,:+()/]`)
+
+// ApplyConditional replaces each tag that has a key:conditional with the
+// value that holds on date, when one of the conditions does. When several
+// hold the last one wins.
+func ApplyConditional(types map[string]string, date time.Time) {
+	var keys []string
+	for key := range types {
+		if strings.HasSuffix(key, ":conditional") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := Conditional(types[key], date); ok {
+			types[strings.TrimSuffix(key, ":conditional")] = value
+		}
+	}
+}
+
+// Conditional evaluates a conditional restriction such as
+// "no @ (Nov-Apr); yes @ (Sa,Su)" for a day, returning the value that
+// applies and false if none does.
+func Conditional(tag string, date time.Time) (string, bool) {
+	result, found := "", false
+	for _, restriction := range splitOutside(tag, ";") {
+		at := strings.Index(restriction, "@")
+		if at < 0 {
+			continue
+		}
+		value := strings.TrimSpace(restriction[:at])
+		condition := strings.TrimSpace(restriction[at+1:])
+		if strings.HasPrefix(condition, "(") && strings.HasSuffix(condition, ")") {
+			condition = condition[1 : len(condition)-1]
+		}
+		applies := true
+		for _, part := range strings.Split(condition, " AND ") {
+			r, ok := parseRule(part)
+			if !ok || r.state != "" {
+				applies = false
+				break
+			}
+			if r.timed && restrictive[value] {
+				applies = false
+				break
+			}
+			applies = applies && r.matches(date)
+		}
+		if applies {
+			result, found = value, true
+		}
+	}
+	return result, found
+}
+
+// OpeningHours reports whether an opening_hours value is open at any time
+// on date. ok is false when the value could not be read, in which case the
+// trail should be treated as open.
+func OpeningHours(tag string, date time.Time) (open bool, ok bool) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return true, false
+	}
+	open = false
+	for _, rule := range splitOutside(strings.Replace(tag, "||", ";", -1), ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		r, ok := parseRule(rule)
+		if !ok {
+			return true, false
+		}
+		// later rules override earlier ones for the days they cover
+		if r.matches(date) {
+			open = r.state != "off" && r.state != "closed"
+		}
+	}
+	return open, true
+}
+
+// splitOutside splits s on sep, ignoring any inside brackets.
+func splitOutside(s string, sep string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '(':
+			depth++
+		case s[i] == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + len(sep)
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+// monthRange is an inclusive range of days in the year, wrapping past the
+// new year when it ends before it starts. Years of 0 are any year; with
+// years it runs from start in startYear to end in endYear.
+type monthRange struct {
+	startYear, endYear int
+	start, end         int
+}
+
+type weekdayRange struct {
+	start, end time.Weekday
+}
+
+// rule is one opening_hours rule.
+type rule struct {
+	months   []monthRange
+	weekdays []weekdayRange
+	timed    bool
+	state    string
+}
+
+// dayOfYear numbers days month*100+day so ranges compare the same way in
+// leap years and others.
+func dayOfYear(month time.Month, day int) int {
+	return int(month)*100 + day
+}
+
+func (r rule) matches(date time.Time) bool {
+	if len(r.months) > 0 {
+		matched := false
+		day := dayOfYear(date.Month(), date.Day())
+		for _, m := range r.months {
+			if m.startYear != 0 {
+				// with years the range is one stretch of time, not one
+				// that comes round every year
+				at := date.Year()*10000 + day
+				if at >= m.startYear*10000+m.start && at <= m.endYear*10000+m.end {
+					matched = true
+				}
+				continue
+			}
+			if m.start <= m.end && day >= m.start && day <= m.end ||
+				m.start > m.end && (day >= m.start || day <= m.end) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.weekdays) > 0 {
+		matched := false
+		for _, w := range r.weekdays {
+			if w.start <= w.end && date.Weekday() >= w.start && date.Weekday() <= w.end ||
+				w.start > w.end && (date.Weekday() >= w.start || date.Weekday() <= w.end) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRule reads the selectors of a rule: years and months, weekdays,
+// times and a closing off or closed.
+func parseRule(s string) (rule, bool) {
+	var r rule
+	// open all day is all that 24/7 means here
+	s = strings.Replace(s, "24/7", "00:00-24:00", -1)
+	tokens := tokenPattern.FindAllString(s, -1)
+	if withoutSpace(strings.Join(tokens, "")) != withoutSpace(s) {
+		return r, false
+	}
+	p := parser{tokens: tokens}
+
+	// years and months
+	for p.isYear() || p.isMonth() {
+		m, ok := p.monthRange()
+		if !ok {
+			return r, false
+		}
+		r.months = append(r.months, m)
+		if !p.accept(",") {
+			break
+		}
+	}
+	p.accept(":")
+
+	// weekdays; PH and SH are holidays, which this does not know
+	for p.isWeekday() || p.peek() == "PH" || p.peek() == "SH" {
+		if p.peek() == "PH" || p.peek() == "SH" {
+			p.next()
+			r.weekdays = append(r.weekdays, weekdayRange{-1, -1})
+		} else {
+			start := weekdayNames[strings.ToLower(p.next())]
+			end := start
+			if p.accept("-") {
+				if !p.isWeekday() {
+					return r, false
+				}
+				end = weekdayNames[strings.ToLower(p.next())]
+			}
+			r.weekdays = append(r.weekdays, weekdayRange{start, end})
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	// times, only noted since the day is all that matters
+	for p.isTime() || p.peek() == "(" {
+		r.timed = true
+		p.next()
+		for strings.Contains("-,+()", p.peek()) && !p.done() || p.isTime() {
+			p.next()
+		}
+	}
+
+	switch strings.ToLower(p.peek()) {
+	case "off", "closed", "open", "unknown":
+		r.state = strings.ToLower(p.next())
+	}
+	if strings.HasPrefix(p.peek(), "\"") {
+		p.next()
+	}
+	if !p.done() || len(r.months) == 0 && len(r.weekdays) == 0 && !r.timed && r.state == "" {
+		return r, false
+	}
+	return r, true
+}
+
+func withoutSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) accept(t string) bool {
+	if p.peek() == t {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) isYear() bool {
+	t := p.peek()
+	return len(t) == 4 && t[0] >= '0' && t[0] <= '9'
+}
+
+func (p *parser) isMonth() bool {
+	_, ok := monthNames[strings.ToLower(p.peek())]
+	return ok
+}
+
+func (p *parser) isWeekday() bool {
+	_, ok := weekdayNames[strings.ToLower(p.peek())]
+	return ok
+}
+
+func (p *parser) isDay() bool {
+	t := p.peek()
+	return len(t) > 0 && len(t) <= 2 && t[0] >= '0' && t[0] <= '9'
+}
+
+func (p *parser) isTime() bool {
+	t := strings.ToLower(p.peek())
+	return strings.Contains(t, ":") && len(t) > 1 ||
+		t == "sunrise" || t == "sunset" || t == "dawn" || t == "dusk"
+}
+
+// monthDate reads [year] month [day]; day is 0 when left out.
+func (p *parser) monthDate() (int, time.Month, int, bool) {
+	year := 0
+	if p.isYear() {
+		year, _ = strconv.Atoi(p.next())
+	}
+	if !p.isMonth() {
+		return 0, 0, 0, false
+	}
+	month := monthNames[strings.ToLower(p.next())]
+	day := 0
+	if p.isDay() {
+		day, _ = strconv.Atoi(p.next())
+	}
+	return year, month, day, true
+}
+
+// monthRange reads Nov, Nov-Apr, Dec 24-26, Nov 15-Apr 15 and the same with
+// years in front.
+func (p *parser) monthRange() (monthRange, bool) {
+	year, month, day, ok := p.monthDate()
+	if !ok {
+		return monthRange{}, false
+	}
+	m := monthRange{startYear: year, endYear: year}
+	m.start = dayOfYear(month, day)
+	if day == 0 {
+		m.start = dayOfYear(month, 1)
+	}
+	endMonth, endDay := month, day
+	if p.accept("-") {
+		if p.isDay() {
+			endDay, _ = strconv.Atoi(p.next())
+		} else {
+			endYear, toMonth, toDay, ok := p.monthDate()
+			if !ok {
+				return monthRange{}, false
+			}
+			if endYear != 0 {
+				m.endYear = endYear
+			}
+			endMonth, endDay = toMonth, toDay
+		}
+	}
+	if endDay == 0 {
+		endDay = 31
+	}
+	m.end = dayOfYear(endMonth, endDay)
+	// 2026 Nov-Feb runs into the next year
+	if m.startYear != 0 && m.endYear == m.startYear && m.end < m.start {
+		m.endYear++
+	}
+	if m.startYear != 0 && m.endYear < m.startYear {
+		return monthRange{}, false
+	}
+	return m, true
+}
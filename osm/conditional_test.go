@@ -0,0 +1,148 @@
+package openStreetMap
+
+import (
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestConditional(t *testing.T) {
+	tests := []struct {
+		tag   string
+		date  string
+		value string
+		ok    bool
+	}{
+		// seasonal ranges, wrapping the new year
+		{"no @ (Nov-Apr)", "2026-12-01", "no", true},
+		{"no @ (Nov-Apr)", "2026-04-30", "no", true},
+		{"no @ (Nov-Apr)", "2026-05-01", "", false},
+		{"no @ (Nov-Apr)", "2026-10-31", "", false},
+		{"no @ (Dec 01-Mar 31)", "2026-03-31", "no", true},
+		{"no @ (Dec 01-Mar 31)", "2026-04-01", "", false},
+		{"no @ (Apr 15-Oct 15)", "2026-04-14", "", false},
+		{"no @ (Apr 15-Oct 15)", "2026-04-15", "no", true},
+		{"no @ (Dec 24-26)", "2026-12-25", "no", true},
+		{"no @ (Dec 24-26)", "2026-12-27", "", false},
+		{"no @ (Jan,Jul)", "2026-07-04", "no", true},
+		// ranges with years are one stretch of time
+		{"no @ (2026 Nov-2027 Apr)", "2026-12-01", "no", true},
+		{"no @ (2026 Nov-2027 Apr)", "2027-03-01", "no", true},
+		{"no @ (2026 Nov-2027 Apr)", "2026-03-01", "", false},
+		{"no @ (2026 Nov-2027 Apr)", "2027-11-01", "", false},
+		{"no @ (2026 Nov-Feb)", "2027-01-10", "no", true},
+		{"no @ (2026 Nov-Feb)", "2026-01-10", "", false},
+		{"no @ (2026 Dec 01-2027 Jan 15)", "2027-01-15", "no", true},
+		{"no @ (2026 Dec 01-2027 Jan 15)", "2027-01-16", "", false},
+		// weekdays; 2026-10-17 is a Saturday
+		{"yes @ (Sa,Su)", "2026-10-17", "yes", true},
+		{"yes @ (Sa,Su)", "2026-10-19", "", false},
+		{"no @ (Mo-Fr)", "2026-10-16", "no", true},
+		{"no @ (Fr-Mo)", "2026-10-18", "no", true},
+		{"no @ (Fr-Mo)", "2026-10-21", "", false},
+		// holidays are not known, so never match
+		{"no @ (PH)", "2026-12-25", "", false},
+		{"no @ (Sa,Su,PH)", "2026-10-17", "no", true},
+		{"no @ (SH)", "2026-07-15", "", false},
+		// a restriction for part of the day does not close the day
+		{"no @ (Mo-Fr 07:00-09:00)", "2026-10-19", "", false},
+		{"no @ (sunset-sunrise)", "2026-10-19", "", false},
+		{"yes @ (Sa 08:00-12:00)", "2026-10-17", "yes", true},
+		// the last matching condition wins
+		{"no @ (Nov-Apr); yes @ (Sa,Su)", "2026-12-05", "yes", true},
+		{"no @ (Nov-Apr); yes @ (Sa,Su)", "2026-12-07", "no", true},
+		{"no @ (Nov-Apr AND Sa,Su)", "2026-12-05", "no", true},
+		{"no @ (Nov-Apr AND Sa,Su)", "2026-12-07", "", false},
+		// conditions this cannot read are left out
+		{"no @ wet", "2026-12-01", "", false},
+		{"no @ (weight>3.5)", "2026-12-01", "", false},
+		{"no @ (Nov-Apr AND wet)", "2026-12-01", "", false},
+		{"no @ (week 01-10)", "2026-01-05", "", false},
+		{"no", "2026-12-01", "", false},
+		{"", "2026-12-01", "", false},
+	}
+	for _, test := range tests {
+		value, ok := Conditional(test.tag, day(test.date))
+		if value != test.value || ok != test.ok {
+			t.Errorf("Conditional(%q, %s) = %q, %v, want %q, %v", test.tag, test.date, value, ok, test.value, test.ok)
+		}
+	}
+}
+
+func TestOpeningHours(t *testing.T) {
+	tests := []struct {
+		tag  string
+		date string
+		open bool
+		ok   bool
+	}{
+		{"24/7", "2026-12-01", true, true},
+		{"sunrise-sunset", "2026-12-01", true, true},
+		{"Mo-Su 06:00-20:00", "2026-12-01", true, true},
+		{"Mo-Fr 06:00-20:00", "2026-10-17", false, true},
+		{"Mo-Fr 06:00-20:00; Sa,Su 08:00-18:00", "2026-10-17", true, true},
+		{"Mo-Fr 06:00-09:00,17:00-20:00", "2026-10-19", true, true},
+		{"Mo-Su (sunrise-00:30)-(sunset+00:30)", "2026-10-19", true, true},
+		// seasons
+		{"Apr-Oct", "2026-07-01", true, true},
+		{"Apr-Oct", "2026-12-01", false, true},
+		{"Apr-Oct: 24/7", "2026-12-01", false, true},
+		{"Apr 15-Oct 31: sunrise-sunset; Nov-Apr 14 off", "2026-04-14", false, true},
+		{"Apr 15-Oct 31: sunrise-sunset; Nov-Apr 14 off", "2026-04-15", true, true},
+		{"2026 Nov-2027 Mar off", "2026-06-01", false, true},
+		{"24/7; 2026 Nov-2027 Mar off", "2026-06-01", true, true},
+		{"24/7; 2026 Nov-2027 Mar off", "2027-02-01", false, true},
+		{"24/7; 2026 Nov-2027 Mar off", "2027-06-01", true, true},
+		// off and closed override earlier rules for their days
+		{"24/7; Nov-Apr off", "2026-12-01", false, true},
+		{"24/7; Nov-Apr closed", "2026-12-01", false, true},
+		{"24/7; Nov-Apr off", "2026-06-01", true, true},
+		{"Mo-Su 08:00-18:00; PH off", "2026-12-25", true, true},
+		{"off", "2026-06-01", false, true},
+		{"closed", "2026-06-01", false, true},
+		{"24/7 \"call ahead\"", "2026-06-01", true, true},
+		// what cannot be read is treated as open
+		{"", "2026-06-01", true, false},
+		{"when the snow melts", "2026-06-01", true, false},
+		{"24/7 || \"by appointment\"", "2026-06-01", true, false},
+		{"Mo[1] 10:00-12:00", "2026-06-01", true, false},
+		{"week 01-10 off", "2026-01-05", true, false},
+		{"Nov-", "2026-12-01", true, false},
+		{"Mo- 10:00", "2026-12-01", true, false},
+	}
+	for _, test := range tests {
+		open, ok := OpeningHours(test.tag, day(test.date))
+		if open != test.open || ok != test.ok {
+			t.Errorf("OpeningHours(%q, %s) = %v, %v, want %v, %v", test.tag, test.date, open, ok, test.open, test.ok)
+		}
+	}
+}
+
+func TestApplyConditional(t *testing.T) {
+	types := map[string]string{
+		"highway":             "path",
+		"bicycle":             "yes",
+		"bicycle:conditional": "no @ (Nov-Apr)",
+		"foot":                "yes",
+		"foot:conditional":    "no @ (wet)",
+	}
+	ApplyConditional(types, day("2026-12-01"))
+	if types["bicycle"] != "no" {
+		t.Errorf("bicycle = %q in December, want no", types["bicycle"])
+	}
+	if types["foot"] != "yes" {
+		t.Errorf("foot = %q, want yes left alone", types["foot"])
+	}
+	types["bicycle"] = "yes"
+	ApplyConditional(types, day("2026-06-01"))
+	if types["bicycle"] != "yes" {
+		t.Errorf("bicycle = %q in June, want yes", types["bicycle"])
+	}
+}
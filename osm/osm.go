@@ -6,19 +6,26 @@ import (
 )
 
 type Node struct {
-	XMLName xml.Name `xml:"node"`
-	Id      string   `xml:"id,attr"`
-	Visible bool     `xml:"visible,attr"`
-	Uid     int      `xml:"uid,attr"`
-	Lat     float64  `xml:"lat,attr"`
-	Lon     float64  `xml:"lon,attr"`
-	Tags    Tag      `xml:"tag"`
-	Name    string   `xml:"name,attr"`
-	Wayid   string   `xml:"wayid"`
-	Type    string   `xml:"type,attr"`
-	Ski     Ski      `json:"ski"`
-	Mtnbike Mtnbike  `json:"mtnbike"`
-	Foot    Foot     `json:"foot"`
+	XMLName    xml.Name `xml:"node"`
+	Id         string   `xml:"id,attr"`
+	Visible    bool     `xml:"visible,attr"`
+	Uid        int      `xml:"uid,attr"`
+	Lat        float64  `xml:"lat,attr"`
+	Lon        float64  `xml:"lon,attr"`
+	Tags       []Tag    `xml:"tag"`
+	Name       string   `xml:"name,attr"`
+	Wayid      string   `xml:"wayid"`
+	Type       string   `xml:"type,attr"`
+	Ski        Ski      `json:"ski"`
+	Mtnbike    Mtnbike  `json:"mtnbike"`
+	Foot       Foot     `json:"foot"`
+	Park       string   `json:"park"`
+	NameSource string   `json:"name_source"`
+	// WayTags are the tags of the way the node was matched to
+	WayTags []Tag `xml:"-" json:"way_tags"`
+	// Segment is the id of the junction to junction stretch of the way the
+	// node is on, when trails are split
+	Segment string `xml:"-" json:"segment,omitempty"`
 }
 type Foot struct {
 	Diff    string `json:"difficulty"`
@@ -36,19 +43,34 @@ type Mtnbike struct {
 	Surface     string `json:"surface"`
 }
 type Osm struct {
-	Ways  []Way  `xml:"way"`
-	Nodes []Node `xml:"node"`
+	Ways      []Way      `xml:"way"`
+	Nodes     []Node     `xml:"node"`
+	Relations []Relation `xml:"relation"`
 }
 type Way struct {
-	XMLName xml.Name `xml:"way"`
-	Tags    []Tag    `xml:"tag"`
-	Nds     []Nd     `xml:"nd"`
+	XMLName    xml.Name `xml:"way"`
+	Tags       []Tag    `xml:"tag"`
+	Nds        []Nd     `xml:"nd"`
+	Id         string   `xml:"id,attr"`
+	Name       string   `xml:"name,attr"`
+	Type       string   `xml:"type,attr"`
+	Ski        Ski      `json:"ski"`
+	Mtnbike    Mtnbike  `json:"mtnbike"`
+	Foot       Foot     `json:"foot"`
+	Park       string   `json:"park"`
+	NameSource string   `json:"name_source"`
+}
+type Relation struct {
+	XMLName xml.Name `xml:"relation"`
 	Id      string   `xml:"id,attr"`
-	Name    string   `xml:"name,attr"`
+	Members []Member `xml:"member"`
+	Tags    []Tag    `xml:"tag"`
+}
+type Member struct {
+	XMLName xml.Name `xml:"member"`
 	Type    string   `xml:"type,attr"`
-	Ski     Ski      `json:"ski"`
-	Mtnbike Mtnbike  `json:"mtnbike"`
-	Foot    Foot     `json:"foot"`
+	Ref     string   `xml:"ref,attr"`
+	Role    string   `xml:"role,attr"`
 }
 
 type Tag struct {
@@ -62,6 +84,14 @@ type Nd struct {
 	Name    string   `xml:"name,attr"`
 }
 
+func TagMap(tags []Tag) map[string]string {
+	types := make(map[string]string)
+	for _, tag := range tags {
+		types[tag.Key] = tag.Value
+	}
+	return types
+}
+
 func CombineWays(way Way, way2 Way) (Way, bool) {
 	nodes := way.Nds
 	nodes_2 := way2.Nds
@@ -0,0 +1,179 @@
+package parks
+
+import (
+	"github.com/mingram/trail/clip"
+	"github.com/mingram/trail/osm"
+	"math"
+)
+
+type Park struct {
+	Id   string
+	Name string
+	Area clip.Area
+	size float64
+}
+
+// IsPark reports whether the tags describe a park, forest or other
+// protected area a trail can belong to.
+func IsPark(types map[string]string) bool {
+	return types["boundary"] == "protected_area" ||
+		types["boundary"] == "national_park" ||
+		types["leisure"] == "park"
+}
+
+// FromOsm builds the outline of every named park in the extract, from
+// multipolygon and boundary relations as well as simple closed ways.
+func FromOsm(osm openStreetMap.Osm) []Park {
+	nodes := make(map[string]openStreetMap.Node, len(osm.Nodes))
+	for _, node := range osm.Nodes {
+		nodes[node.Id] = node
+	}
+	ways := make(map[string]openStreetMap.Way, len(osm.Ways))
+	for _, way := range osm.Ways {
+		ways[way.Id] = way
+	}
+
+	var parks []Park
+	for _, relation := range osm.Relations {
+		types := openStreetMap.TagMap(relation.Tags)
+		if !IsPark(types) || types["name"] == "" {
+			continue
+		}
+		if types["type"] != "multipolygon" && types["type"] != "boundary" {
+			continue
+		}
+		var outers, inners [][]openStreetMap.Nd
+		for _, member := range relation.Members {
+			way, ok := ways[member.Ref]
+			if member.Type != "way" || !ok {
+				continue
+			}
+			if member.Role == "inner" {
+				inners = append(inners, way.Nds)
+			} else {
+				outers = append(outers, way.Nds)
+			}
+		}
+		area := buildArea(assemble(outers, nodes), assemble(inners, nodes))
+		if len(area.Polygons) > 0 {
+			parks = append(parks, newPark("relation/"+relation.Id, types["name"], area))
+		}
+	}
+	for _, way := range osm.Ways {
+		types := openStreetMap.TagMap(way.Tags)
+		if !IsPark(types) || types["name"] == "" {
+			continue
+		}
+		rings := assemble([][]openStreetMap.Nd{way.Nds}, nodes)
+		if len(rings) > 0 {
+			parks = append(parks, newPark("way/"+way.Id, types["name"], buildArea(rings, nil)))
+		}
+	}
+	return parks
+}
+
+func newPark(id string, name string, area clip.Area) Park {
+	minLon, minLat, maxLon, maxLat := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, polygon := range area.Polygons {
+		for _, point := range polygon[0] {
+			minLon, maxLon = math.Min(minLon, point[0]), math.Max(maxLon, point[0])
+			minLat, maxLat = math.Min(minLat, point[1]), math.Max(maxLat, point[1])
+		}
+	}
+	return Park{Id: id, Name: name, Area: area, size: (maxLon - minLon) * (maxLat - minLat)}
+}
+
+// assemble joins way segments end to end into closed rings. Segments that
+// never close, usually because the extract cut the boundary off, are dropped.
+func assemble(segments [][]openStreetMap.Nd, nodes map[string]openStreetMap.Node) []clip.Ring {
+	used := make([]bool, len(segments))
+	var rings []clip.Ring
+	for i, segment := range segments {
+		if used[i] || len(segment) < 2 {
+			continue
+		}
+		used[i] = true
+		ring := append([]openStreetMap.Nd{}, segment...)
+		for ring[0].Ref != ring[len(ring)-1].Ref {
+			last := ring[len(ring)-1].Ref
+			found := false
+			for x, next := range segments {
+				if used[x] || len(next) < 2 {
+					continue
+				}
+				if next[0].Ref == last {
+					ring = append(ring, next[1:]...)
+				} else if next[len(next)-1].Ref == last {
+					for y := len(next) - 2; y >= 0; y-- {
+						ring = append(ring, next[y])
+					}
+				} else {
+					continue
+				}
+				used[x] = true
+				found = true
+				break
+			}
+			if !found {
+				break
+			}
+		}
+		if ring[0].Ref != ring[len(ring)-1].Ref {
+			continue
+		}
+		var coords clip.Ring
+		for _, nd := range ring {
+			if node, ok := nodes[nd.Ref]; ok {
+				coords = append(coords, []float64{node.Lon, node.Lat})
+			}
+		}
+		if len(coords) >= 4 {
+			rings = append(rings, coords)
+		}
+	}
+	return rings
+}
+
+// buildArea puts each inner ring in the polygon of the outer ring that
+// contains it.
+func buildArea(outers []clip.Ring, inners []clip.Ring) clip.Area {
+	var area clip.Area
+	for _, outer := range outers {
+		area.Polygons = append(area.Polygons, clip.Polygon{outer})
+	}
+	for _, inner := range inners {
+		for i, polygon := range area.Polygons {
+			single := clip.Area{Polygons: []clip.Polygon{{polygon[0]}}}
+			if single.Contains(inner[0][0], inner[0][1]) {
+				area.Polygons[i] = append(area.Polygons[i], inner)
+				break
+			}
+		}
+	}
+	return area
+}
+
+// Containing returns the name of the park holding most of the trail's nodes.
+// When a trail sits in nested areas, like a state park inside a national
+// forest, the smaller one wins.
+func Containing(parks []Park, trail []openStreetMap.Node) string {
+	best, bestCount := -1, 0
+	for i, park := range parks {
+		count := 0
+		for _, node := range trail {
+			if park.Area.Contains(node.Lon, node.Lat) {
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		if count > bestCount || count == bestCount && park.size < parks[best].size {
+			best, bestCount = i, count
+		}
+	}
+	if best == -1 {
+		return ""
+	}
+	return parks[best].Name
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/mingram/trail/osm"
+	"github.com/mingram/trail/units"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// defaultDescription is the placemark description used unless -description
+// gives another one.
+const defaultDescription = `Type: {{.Type}}
+Total Distance: {{distance .Km}}{{if .HasClimb}}, {{height .Climb}} climb{{end}}
+{{- if .Park}}
+Park: {{.Park}}{{end}}
+{{- if .Segment}}
+Segment: {{.Segment}}{{end}}
+{{- if .Status}}
+Status: {{.Status}}{{if .StatusNote}}, {{.StatusNote}}{{end}}{{if .StatusUpdated}} (updated {{.StatusUpdated}}){{end}}{{end}}
+{{- if .SyntheticName}}
+Name: generated, not tagged in OSM{{end}}`
+
+// descriptionData is what a description template is run against. Km and
+// Climb are raw numbers, for the distance and height template functions to
+// turn into text in the chosen units.
+type descriptionData struct {
+	Name          string
+	Type          string
+	Park          string
+	Way           string
+	Segment       string
+	Km            float64
+	Climb         float64
+	HasClimb      bool
+	SyntheticName bool
+	Surface       string
+	Difficulty    string
+	Status        string
+	StatusNote    string
+	StatusUpdated string
+}
+
+// parseDescription reads a description template, from the file after the @
+// if text starts with one.
+func parseDescription(text string, u units.Units) (*template.Template, error) {
+	if strings.HasPrefix(text, "@") {
+		b, err := ioutil.ReadFile(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		text = strings.TrimRight(string(b), "\n")
+	}
+	return template.New("description").Funcs(u.Funcs()).Parse(text)
+}
+
+// trailClimb adds up the height gained along the trail from the ele tags of
+// its nodes, false if fewer than two nodes have one.
+func trailClimb(node []openStreetMap.Node) (float64, bool) {
+	climb, count := 0.0, 0
+	var last float64
+	for _, nd := range node {
+		ele, ok := nodeEle(nd)
+		if !ok {
+			continue
+		}
+		if count > 0 && ele > last {
+			climb += ele - last
+		}
+		last = ele
+		count++
+	}
+	return climb, count > 1
+}
+
+func nodeEle(nd openStreetMap.Node) (float64, bool) {
+	for _, tag := range nd.Tags {
+		if tag.Key == "ele" {
+			ele, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(tag.Value, "m")), 64)
+			return ele, err == nil
+		}
+	}
+	return 0, false
+}
+
+func (opts exportOptions) descriptionData(node []openStreetMap.Node) descriptionData {
+	_, tipo := GetColor(node[0])
+	climb, hasClimb := trailClimb(node)
+	condition, _ := opts.condition(node)
+	return descriptionData{
+		Name:          node[0].Name,
+		Type:          tipo,
+		Park:          node[0].Park,
+		Way:           node[0].Wayid,
+		Segment:       node[0].Segment,
+		Km:            opts.trailLength(node),
+		Climb:         climb,
+		HasClimb:      hasClimb,
+		SyntheticName: syntheticName(node[0].NameSource),
+		Surface:       trailSurface(node[0]),
+		Difficulty:    trailDifficulty(node[0]),
+		Status:        condition.Status,
+		StatusNote:    condition.Note,
+		StatusUpdated: condition.Updated,
+	}
+}
+
+// describe runs the description template for a trail.
+func (opts exportOptions) describe(node []openStreetMap.Node) string {
+	var b strings.Builder
+	if err := opts.Description.Execute(&b, opts.descriptionData(node)); err != nil {
+		log.Print(err)
+	}
+	return b.String()
+}
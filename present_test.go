@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/mingram/trail/osm"
+	"testing"
+)
+
+// eleTrail has one node per ele tag, "" leaving the tag off.
+func eleTrail(eles ...string) []openStreetMap.Node {
+	var node []openStreetMap.Node
+	for _, ele := range eles {
+		var nd openStreetMap.Node
+		if ele != "" {
+			nd.Tags = []openStreetMap.Tag{{Key: "ele", Value: ele}}
+		}
+		node = append(node, nd)
+	}
+	return node
+}
+
+func TestTrailClimb(t *testing.T) {
+	tests := []struct {
+		eles  []string
+		climb float64
+		ok    bool
+	}{
+		{[]string{"100", "150"}, 50, true},
+		// only the ups count
+		{[]string{"100", "150", "120", "170"}, 100, true},
+		{[]string{"200", "150", "100"}, 0, true},
+		// nodes without ele are stepped over
+		{[]string{"100", "", "", "130"}, 30, true},
+		{[]string{"", "100", "", "90", "", "140", ""}, 50, true},
+		// a unit of metres and stray spaces are allowed
+		{[]string{"100 m", " 112.5m"}, 12.5, true},
+		{[]string{"100", "about 300", "110"}, 10, true},
+		{[]string{"100"}, 0, false},
+		{[]string{"100", "", "high"}, 0, false},
+		{[]string{"", ""}, 0, false},
+		{nil, 0, false},
+	}
+	for _, test := range tests {
+		climb, ok := trailClimb(eleTrail(test.eles...))
+		if climb != test.climb || ok != test.ok {
+			t.Errorf("trailClimb(%q) = %v, %v, want %v, %v", test.eles, climb, ok, test.climb, test.ok)
+		}
+	}
+}
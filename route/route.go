@@ -0,0 +1,121 @@
+package route
+
+import (
+	"container/heap"
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/osm"
+	"math"
+)
+
+type edge struct {
+	to    string
+	km    float64
+	trail int
+}
+
+// Graph is the trail network, joined wherever trails share a node.
+type Graph struct {
+	nodes  map[string]openStreetMap.Node
+	edges  map[string][]edge
+	metric geo.Metric
+}
+
+// NewGraph joins up the trails, measuring their edges with metric.
+func NewGraph(trails [][]openStreetMap.Node, metric geo.Metric) *Graph {
+	g := &Graph{nodes: make(map[string]openStreetMap.Node), edges: make(map[string][]edge), metric: metric}
+	for i, trail := range trails {
+		for x, node := range trail {
+			g.nodes[node.Id] = node
+			if x == 0 {
+				continue
+			}
+			prev := trail[x-1]
+			km := g.distance(prev, node)
+			g.edges[prev.Id] = append(g.edges[prev.Id], edge{node.Id, km, i})
+			g.edges[node.Id] = append(g.edges[node.Id], edge{prev.Id, km, i})
+		}
+	}
+	return g
+}
+
+func (g *Graph) distance(a openStreetMap.Node, b openStreetMap.Node) float64 {
+	return g.metric(geo.Point{Lon: a.Lon, Lat: a.Lat}, geo.Point{Lon: b.Lon, Lat: b.Lat})
+}
+
+// Nearest returns the id of the node on the network closest to lon/lat.
+func (g *Graph) Nearest(lon float64, lat float64) (string, bool) {
+	best, bestDistance := "", math.Inf(1)
+	target := openStreetMap.Node{Lat: lat, Lon: lon}
+	for id, node := range g.nodes {
+		if d := g.distance(target, node); d < bestDistance || d == bestDistance && id < best {
+			best, bestDistance = id, d
+		}
+	}
+	return best, best != ""
+}
+
+// Path is a route across the network.
+type Path struct {
+	Nodes []openStreetMap.Node
+	Km    float64
+	// Trails are the indexes of the trails used, in the order they are ridden
+	Trails []int
+}
+
+// Shortest finds the shortest path between two nodes with Dijkstra.
+func (g *Graph) Shortest(from string, to string) (Path, bool) {
+	dist := map[string]float64{from: 0}
+	prev := make(map[string]edge)
+	queue := &nodeQueue{{from, 0}}
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(queued)
+		if current.id == to {
+			break
+		}
+		if current.km > dist[current.id] {
+			continue
+		}
+		for _, e := range g.edges[current.id] {
+			km := current.km + e.km
+			if d, ok := dist[e.to]; !ok || km < d {
+				dist[e.to] = km
+				prev[e.to] = edge{current.id, e.km, e.trail}
+				heap.Push(queue, queued{e.to, km})
+			}
+		}
+	}
+	if _, ok := dist[to]; !ok {
+		return Path{}, false
+	}
+
+	path := Path{Km: dist[to]}
+	for id := to; ; {
+		path.Nodes = append([]openStreetMap.Node{g.nodes[id]}, path.Nodes...)
+		if id == from {
+			break
+		}
+		e := prev[id]
+		if len(path.Trails) == 0 || path.Trails[0] != e.trail {
+			path.Trails = append([]int{e.trail}, path.Trails...)
+		}
+		id = e.to
+	}
+	return path, true
+}
+
+type queued struct {
+	id string
+	km float64
+}
+type nodeQueue []queued
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].km < q[j].km }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(queued)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
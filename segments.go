@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mingram/trail/osm"
+)
+
+// splitTrails cuts every trail at each node it shares with another trail,
+// or with itself, giving junction to junction segments. Segments keep the
+// way they came from, in order along it, and get their id on every node.
+func splitTrails(ways []openStreetMap.Way, nodes [][]openStreetMap.Node) ([]openStreetMap.Way, [][]openStreetMap.Node) {
+	uses := make(map[string]int)
+	for _, node := range nodes {
+		for j, nd := range node {
+			// the closing node of a loop is not a second use
+			if j == len(node)-1 && j > 0 && nd.Id == node[0].Id {
+				continue
+			}
+			uses[nd.Id]++
+		}
+	}
+
+	var splitWays []openStreetMap.Way
+	var splitNodes [][]openStreetMap.Node
+	for i, node := range nodes {
+		if len(node) < 2 {
+			splitWays = append(splitWays, ways[i])
+			splitNodes = append(splitNodes, node)
+			continue
+		}
+		seen := make(map[string]int)
+		start := 0
+		for j := 1; j < len(node); j++ {
+			if j < len(node)-1 && uses[node[j].Id] < 2 {
+				continue
+			}
+			segment := make([]openStreetMap.Node, j-start+1)
+			copy(segment, node[start:j+1])
+			from, to := endIds(segment)
+			id := segmentId(node[0].Wayid, from, to)
+			// a way can pass between the same two junctions twice
+			seen[id]++
+			if seen[id] > 1 {
+				id = fmt.Sprintf("%s.%d", id, seen[id])
+			}
+			for k := range segment {
+				segment[k].Segment = id
+			}
+			splitWays = append(splitWays, ways[i])
+			splitNodes = append(splitNodes, segment)
+			start = j
+		}
+	}
+	return splitWays, splitNodes
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mingram/trail/clip"
+	"github.com/mingram/trail/gpx"
+	"github.com/mingram/trail/osm"
+	"github.com/mingram/trail/route"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// trailServer answers API requests from a trail set loaded once at startup.
+type trailServer struct {
+	ways  []openStreetMap.Way
+	nodes [][]openStreetMap.Node
+	opts  exportOptions
+	graph *route.Graph
+}
+
+type TrailSummary struct {
+	Id         string     `json:"id"`
+	TrailId    string     `json:"trail_id"`
+	Name       string     `json:"name"`
+	Park       string     `json:"park,omitempty"`
+	Activity   string     `json:"activity"`
+	Color      string     `json:"color"`
+	Difficulty string     `json:"difficulty,omitempty"`
+	LengthKm   float64    `json:"length_km"`
+	Bbox       [4]float64 `json:"bbox"`
+}
+
+func serve(addr string, ways []openStreetMap.Way, nodes [][]openStreetMap.Node, opts exportOptions) error {
+	s := &trailServer{ways: ways, nodes: nodes, opts: opts, graph: route.NewGraph(nodes, opts.Metric)}
+	log.Print("Serving " + fmt.Sprintf("%v", len(nodes)) + " trails on " + addr)
+	return http.ListenAndServe(addr, s.handler())
+}
+
+func (s *trailServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trails", s.list)
+	mux.HandleFunc("/trails/", s.trail)
+	mux.HandleFunc("/bbox", s.bbox)
+	mux.HandleFunc("/route", s.route)
+	return mux
+}
+
+func (opts exportOptions) summary(node []openStreetMap.Node) TrailSummary {
+	color, tipo := GetColor(node[0])
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, nd := range node {
+		bbox[0], bbox[1] = math.Min(bbox[0], nd.Lon), math.Min(bbox[1], nd.Lat)
+		bbox[2], bbox[3] = math.Max(bbox[2], nd.Lon), math.Max(bbox[3], nd.Lat)
+	}
+	return TrailSummary{
+		Id:         node[0].Wayid,
+		TrailId:    opts.trailId(node),
+		Name:       node[0].Name,
+		Park:       node[0].Park,
+		Activity:   tipo,
+		Color:      color,
+		Difficulty: trailDifficulty(node[0]),
+		LengthKm:   opts.trailLength(node),
+		Bbox:       bbox,
+	}
+}
+
+// list handles GET /trails?q=&park=&activity=, matching names, parks and
+// activity types case-insensitively.
+func (s *trailServer) list(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(r.URL.Query().Get("q"))
+	park := strings.ToLower(r.URL.Query().Get("park"))
+	activity := strings.ToLower(r.URL.Query().Get("activity"))
+
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, "[")
+	encoder := json.NewEncoder(w)
+	first := true
+	for _, node := range s.nodes {
+		trail := s.opts.summary(node)
+		if !strings.Contains(strings.ToLower(trail.Name), q) ||
+			park != "" && strings.ToLower(trail.Park) != park ||
+			!strings.Contains(strings.ToLower(trail.Activity), activity) {
+			continue
+		}
+		if !first {
+			io.WriteString(w, ",")
+		}
+		first = false
+		encoder.Encode(trail)
+	}
+	io.WriteString(w, "]")
+}
+
+// trail handles GET /trails/{way id}[.geojson|.kml|.gpx]. Ways split by
+// clipping come back together in one document; a trail id instead of a way
+// id gets just that trail or segment.
+func (s *trailServer) trail(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/trails/")
+	format := ""
+	trails := s.find(id)
+	// segment ids can end in .2, so the end is only a format when the
+	// whole id is not found
+	if ext := strings.TrimPrefix(path.Ext(id), "."); len(trails) == 0 && isFormat(ext) {
+		format = ext
+		trails = s.find(strings.TrimSuffix(id, path.Ext(id)))
+	}
+	if f := r.URL.Query().Get("format"); f != "" {
+		format = f
+	}
+	if len(trails) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	s.write(w, format, trails[0][0].Name, trails)
+}
+
+func isFormat(format string) bool {
+	_, ok := exporters[format]
+	return ok || format == "json"
+}
+
+// find returns the trails with the way id or trail id id.
+func (s *trailServer) find(id string) [][]openStreetMap.Node {
+	var trails [][]openStreetMap.Node
+	for _, node := range s.nodes {
+		if node[0].Wayid == id || s.opts.trailId(node) == id {
+			trails = append(trails, node)
+		}
+	}
+	return trails
+}
+
+// bbox handles GET /bbox?bbox=minLon,minLat,maxLon,maxLat&format=, returning
+// every trail with a node inside the box.
+func (s *trailServer) bbox(w http.ResponseWriter, r *http.Request) {
+	area, err := clip.ParseBBox(r.URL.Query().Get("bbox"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var trails [][]openStreetMap.Node
+	for _, node := range s.nodes {
+		for _, nd := range node {
+			if area.Contains(nd.Lon, nd.Lat) {
+				trails = append(trails, node)
+				break
+			}
+		}
+	}
+	s.write(w, r.URL.Query().Get("format"), "Trails", trails)
+}
+
+// route handles GET /route?from=lon,lat&to=lon,lat, snapping both ends to
+// the nearest trail node and returning the shortest path over the network.
+// Ends that snap to the same node are a bad request, as there is no line
+// to return.
+func (s *trailServer) route(w http.ResponseWriter, r *http.Request) {
+	var ends []string
+	for _, param := range []string{"from", "to"} {
+		lon, lat, err := parseLonLat(r.URL.Query().Get(param))
+		if err != nil {
+			http.Error(w, param+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, ok := s.graph.Nearest(lon, lat)
+		if !ok {
+			http.Error(w, "no trails loaded", http.StatusNotFound)
+			return
+		}
+		ends = append(ends, id)
+	}
+	if ends[0] == ends[1] {
+		http.Error(w, "from and to are nearest the same trail node", http.StatusBadRequest)
+		return
+	}
+	found, ok := s.graph.Shortest(ends[0], ends[1])
+	if !ok {
+		http.Error(w, "no route between those points", http.StatusNotFound)
+		return
+	}
+
+	var names, ids []string
+	for _, i := range found.Trails {
+		names = append(names, s.nodes[i][0].Name)
+		ids = append(ids, s.opts.trailId(s.nodes[i]))
+	}
+	var coordinates [][]float64
+	for _, nd := range found.Nodes {
+		coordinates = append(coordinates, []float64{nd.Lon, nd.Lat})
+	}
+	description := fmt.Sprintf("%f", found.Km) + " km via " + strings.Join(names, ", ")
+
+	if r.URL.Query().Get("format") == "gpx" {
+		GPX := gpx.NewGpx("Route")
+		GPX.AddTrack("Route", description, coordinates)
+		w.Header().Set("Content-Type", "application/gpx+xml")
+		if err := GPX.Encode(w); err != nil {
+			log.Print("Writing gpx response: " + err.Error())
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/geo+json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":     "Feature",
+		"id":       routeId(found.Nodes),
+		"geometry": Geometry{"LineString", coordinates},
+		"properties": map[string]interface{}{
+			"distance_km": found.Km,
+			"trails":      names,
+			"trail_ids":   ids,
+		},
+	})
+}
+
+func parseLonLat(s string) (float64, float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("want lon,lat")
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lon, lat, nil
+}
+
+// write sends trails as GeoJSON (the default) or any other registered
+// format. Formats that can stream, GeoJSON, KML and GPX, are written a
+// trail at a time so big bbox queries are never held in memory.
+func (s *trailServer) write(w http.ResponseWriter, format string, name string, trails [][]openStreetMap.Node) {
+	if format == "" || format == "json" {
+		format = "geojson"
+	}
+	exporter, ok := exporters[format]
+	if !ok {
+		http.Error(w, "unknown format "+format+", want one of "+strings.Join(exporterNames(), ", "), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", exporter.ContentType())
+	var err error
+	if streamer, ok := exporter.(Streamer); ok {
+		err = streamer.Stream(w, name, s.opts, trails)
+	} else {
+		doc := exporter.NewDocument(name, s.opts)
+		for _, node := range trails {
+			doc.Add(node)
+		}
+		err = doc.Encode(w)
+	}
+	if err != nil {
+		// the status is already sent, all that is left is to say so here
+		log.Print("Writing " + format + " response: " + err.Error())
+	}
+}
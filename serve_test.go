@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"github.com/mingram/trail/geo"
+	"github.com/mingram/trail/osm"
+	"github.com/mingram/trail/route"
+	"github.com/mingram/trail/units"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// loopServer serves way 1, which runs 10, 11, 20, 12, 10, 13, 20 and so
+// passes from junction 10 to junction 20 twice once it is split.
+func loopServer() *trailServer {
+	ids := []string{"10", "11", "20", "12", "10", "13", "20"}
+	var node []openStreetMap.Node
+	for i, id := range ids {
+		nd := openStreetMap.Node{Id: id, Lon: -77.45 + float64(i)*0.001, Lat: 39.52}
+		nd.Name = "Loop Trail"
+		nd.Wayid = "1"
+		node = append(node, nd)
+	}
+	ways, nodes := splitTrails([]openStreetMap.Way{{Id: "1"}}, [][]openStreetMap.Node{node})
+	presentation, err := units.New(units.Metric, "en", 2)
+	if err != nil {
+		panic(err)
+	}
+	description, err := parseDescription(defaultDescription, presentation)
+	if err != nil {
+		panic(err)
+	}
+	opts := exportOptions{Description: description, Units: presentation, Metric: geo.Haversine}
+	return &trailServer{ways: ways, nodes: nodes, opts: opts, graph: route.NewGraph(nodes, opts.Metric)}
+}
+
+func get(t *testing.T, s *trailServer, url string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	return w
+}
+
+func TestTrailIds(t *testing.T) {
+	s := loopServer()
+	tests := []struct {
+		url string
+		ids []string
+	}{
+		{"/trails/way-1-10-20", []string{"way-1-10-20"}},
+		{"/trails/way-1-10-20.2", []string{"way-1-10-20.2"}},
+		{"/trails/way-1-10-20.2.geojson", []string{"way-1-10-20.2"}},
+		{"/trails/way-1-10-20.json", []string{"way-1-10-20"}},
+		{"/trails/1", []string{"way-1-10-20", "way-1-20-10", "way-1-10-20.2"}},
+		{"/trails/way-1-10-20.3", nil},
+		{"/trails/way-1-10-20.shape", nil},
+	}
+	for _, test := range tests {
+		w := get(t, s, test.url)
+		if test.ids == nil {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("GET %s = %d, want 404", test.url, w.Code)
+			}
+			continue
+		}
+		var collection GeoJson
+		if err := json.Unmarshal(w.Body.Bytes(), &collection); err != nil {
+			t.Errorf("GET %s: %v", test.url, err)
+			continue
+		}
+		var ids []string
+		for _, feature := range collection.Features {
+			ids = append(ids, feature.Id)
+		}
+		if len(ids) != len(test.ids) {
+			t.Errorf("GET %s = %v, want %v", test.url, ids, test.ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != test.ids[i] {
+				t.Errorf("GET %s = %v, want %v", test.url, ids, test.ids)
+				break
+			}
+		}
+	}
+}
+
+func TestTrailFormats(t *testing.T) {
+	s := loopServer()
+
+	w := get(t, s, "/trails/way-1-10-20.2.kml")
+	if ct := w.Header().Get("Content-Type"); ct != "application/vnd.google-earth.kml+xml" {
+		t.Errorf("kml Content-Type = %q", ct)
+	}
+	var kml struct {
+		Placemarks []struct {
+			Id string `xml:"id,attr"`
+		} `xml:"Document>Placemark"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &kml); err != nil {
+		t.Fatal(err)
+	}
+	if len(kml.Placemarks) != 1 || kml.Placemarks[0].Id != "way-1-10-20.2" {
+		t.Errorf("kml placemarks = %v, want just way-1-10-20.2", kml.Placemarks)
+	}
+
+	w = get(t, s, "/trails/1?format=gpx")
+	var gpx struct {
+		Name   string `xml:"metadata>name"`
+		Tracks []struct {
+			Points []struct{} `xml:"trkseg>trkpt"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &gpx); err != nil {
+		t.Fatal(err)
+	}
+	if gpx.Name != "Loop Trail" || len(gpx.Tracks) != 3 {
+		t.Errorf("gpx %q has %d tracks, want Loop Trail with 3", gpx.Name, len(gpx.Tracks))
+	}
+	for i, track := range gpx.Tracks {
+		if len(track.Points) != 3 {
+			t.Errorf("gpx track %d has %d points, want 3", i, len(track.Points))
+		}
+	}
+
+	if w := get(t, s, "/trails/1?format=shape"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/mingram/trail/columnar"
+	"github.com/mingram/trail/osm"
+	"github.com/mingram/trail/shp"
+	"strings"
+)
+
+// shapeTags are the OSM tags given their own DBF column. Every tag also
+// goes into osm_tags, cut off at the 254 characters DBF allows.
+var shapeTags = [][2]string{
+	{"highway", "highway"},
+	{"surface", "surface"},
+	{"access", "access"},
+	{"bicycle", "bicycle"},
+	{"foot", "foot"},
+	{"mtb:scale", "mtb_scale"},
+	{"mtb:scale:imba", "mtb_imba"},
+	{"piste:type", "piste_type"},
+	{"piste:difficulty", "piste_diff"},
+	{"sac_scale", "sac_scale"},
+	{"ref", "ref"},
+}
+
+// dbfNames shorten the property names longer than the ten characters a
+// DBF column name can have. Others are used as they are, with - as _.
+var dbfNames = map[string]string{
+	"stroke-width":     "strk_width",
+	"stroke-opacity":   "strk_opac",
+	"fill-opacity":     "fill_opac",
+	"description":      "descr",
+	"name_source":      "name_src",
+	"synthetic_name":   "synth_name",
+	"stroke-dasharray": "strk_dash",
+	"status_note":      "stat_note",
+	"status_updated":   "stat_upd",
+}
+
+// dbfField is the DBF column for a property column. Booleans are Y or N.
+func dbfField(column columnar.Column) shp.Field {
+	name, ok := dbfNames[column.Name]
+	if !ok {
+		name = strings.Replace(column.Name, "-", "_", -1)
+	}
+	switch column.Type {
+	case columnar.Double:
+		return shp.Field{Name: name, Type: shp.Numeric, Length: 12, Decimals: 3}
+	case columnar.Bool:
+		return shp.Field{Name: name, Type: shp.Character, Length: 1}
+	}
+	return shp.Field{Name: name, Type: shp.Character, Length: 254}
+}
+
+// writeShapefile saves the trails as a polyline shapefile whose columns
+// are the GeoJSON properties, as in trailColumns, plus the main OSM tags.
+func (opts exportOptions) writeShapefile(base string, ways []openStreetMap.Way, nodes [][]openStreetMap.Node) error {
+	columns, omitEmpty := propertyColumns()
+	fields := []shp.Field{{Name: "way_id", Type: shp.Character, Length: 20}}
+	for _, column := range columns {
+		fields = append(fields, dbfField(column))
+	}
+	fields = append(fields,
+		shp.Field{Name: "activity", Type: shp.Character, Length: 20},
+		shp.Field{Name: "length_km", Type: shp.Numeric, Length: 12, Decimals: 3},
+	)
+	for _, tag := range shapeTags {
+		fields = append(fields, shp.Field{Name: tag[1], Type: shp.Character, Length: 50})
+	}
+	fields = append(fields, shp.Field{Name: "osm_tags", Type: shp.Character, Length: 254})
+
+	var records []shp.Record
+	for i, node := range nodes {
+		feature := opts.trailFeature(node)
+		_, tipo := GetColor(node[0])
+		values := []interface{}{node[0].Wayid}
+		for j, value := range propertyValues(feature.Properties, omitEmpty) {
+			switch {
+			case columns[j].Type == columnar.Bool:
+				if value == true {
+					value = "Y"
+				} else {
+					value = "N"
+				}
+			case value == nil:
+				value = ""
+			}
+			values = append(values, value)
+		}
+		values = append(values, tipo, opts.trailLength(node))
+		types := openStreetMap.TagMap(ways[i].Tags)
+		for _, tag := range shapeTags {
+			values = append(values, types[tag[0]])
+		}
+		values = append(values, tagString(ways[i].Tags))
+		records = append(records, shp.Record{
+			Parts:  [][][]float64{feature.Geometry.Coordinates},
+			Values: values,
+		})
+	}
+	return shp.WritePolylines(base, fields, records)
+}
@@ -0,0 +1,178 @@
+package shp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	Character = 'C'
+	Numeric   = 'N'
+
+	shapePolyLine = 3
+	headerBytes   = 100
+)
+
+// Field is a DBF column. Names longer than ten characters are cut short,
+// which is all dBase allows.
+type Field struct {
+	Name     string
+	Type     byte
+	Length   int
+	Decimals int
+}
+
+// Record is one polyline, made of one or more parts of [lon, lat] points,
+// and its attribute values in field order.
+type Record struct {
+	Parts  [][][]float64
+	Values []interface{}
+}
+
+const wgs84 = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+
+// WritePolylines writes base.shp, .shx, .dbf, .prj and .cpg.
+func WritePolylines(base string, fields []Field, records []Record) error {
+	var shapes, index bytes.Buffer
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	offset := headerBytes
+	for i, record := range records {
+		content := polyline(record.Parts, &bbox)
+		binary.Write(&shapes, binary.BigEndian, int32(i+1))
+		binary.Write(&shapes, binary.BigEndian, int32(len(content)/2))
+		shapes.Write(content)
+
+		binary.Write(&index, binary.BigEndian, int32(offset/2))
+		binary.Write(&index, binary.BigEndian, int32(len(content)/2))
+		offset += 8 + len(content)
+	}
+	if len(records) == 0 {
+		bbox = [4]float64{}
+	}
+
+	shp := append(header(headerBytes+shapes.Len(), bbox), shapes.Bytes()...)
+	shx := append(header(headerBytes+index.Len(), bbox), index.Bytes()...)
+	dbf, err := table(fields, records)
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		".shp": shp,
+		".shx": shx,
+		".dbf": dbf,
+		".prj": []byte(wgs84),
+		".cpg": []byte("UTF-8"),
+	}
+	for _, ext := range []string{".shp", ".shx", ".dbf", ".prj", ".cpg"} {
+		if err := ioutil.WriteFile(base+ext, files[ext], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func header(length int, bbox [4]float64) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, int32(9994))
+	b.Write(make([]byte, 20))
+	binary.Write(&b, binary.BigEndian, int32(length/2))
+	binary.Write(&b, binary.LittleEndian, int32(1000))
+	binary.Write(&b, binary.LittleEndian, int32(shapePolyLine))
+	binary.Write(&b, binary.LittleEndian, bbox)
+	b.Write(make([]byte, 32))
+	return b.Bytes()
+}
+
+func polyline(parts [][][]float64, total *[4]float64) []byte {
+	bbox := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	var starts []int32
+	var points []float64
+	for _, part := range parts {
+		starts = append(starts, int32(len(points)/2))
+		for _, p := range part {
+			points = append(points, p[0], p[1])
+			bbox[0], bbox[1] = math.Min(bbox[0], p[0]), math.Min(bbox[1], p[1])
+			bbox[2], bbox[3] = math.Max(bbox[2], p[0]), math.Max(bbox[3], p[1])
+		}
+	}
+	total[0], total[1] = math.Min(total[0], bbox[0]), math.Min(total[1], bbox[1])
+	total[2], total[3] = math.Max(total[2], bbox[2]), math.Max(total[3], bbox[3])
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, int32(shapePolyLine))
+	binary.Write(&b, binary.LittleEndian, bbox)
+	binary.Write(&b, binary.LittleEndian, int32(len(starts)))
+	binary.Write(&b, binary.LittleEndian, int32(len(points)/2))
+	binary.Write(&b, binary.LittleEndian, starts)
+	binary.Write(&b, binary.LittleEndian, points)
+	return b.Bytes()
+}
+
+// table builds a dBase III file.
+func table(fields []Field, records []Record) ([]byte, error) {
+	recordLength := 1
+	for _, field := range fields {
+		recordLength += field.Length
+	}
+	var b bytes.Buffer
+	now := time.Now()
+	b.Write([]byte{0x03, byte(now.Year() - 1900), byte(now.Month()), byte(now.Day())})
+	binary.Write(&b, binary.LittleEndian, uint32(len(records)))
+	binary.Write(&b, binary.LittleEndian, uint16(32+32*len(fields)+1))
+	binary.Write(&b, binary.LittleEndian, uint16(recordLength))
+	b.Write(make([]byte, 20))
+	for _, field := range fields {
+		name := make([]byte, 11)
+		copy(name[:10], field.Name)
+		b.Write(name)
+		b.WriteByte(field.Type)
+		b.Write(make([]byte, 4))
+		b.Write([]byte{byte(field.Length), byte(field.Decimals)})
+		b.Write(make([]byte, 14))
+	}
+	b.WriteByte(0x0D)
+
+	for _, record := range records {
+		if len(record.Values) != len(fields) {
+			return nil, fmt.Errorf("record has %d values for %d fields", len(record.Values), len(fields))
+		}
+		b.WriteByte(' ')
+		for i, field := range fields {
+			b.WriteString(cell(field, record.Values[i]))
+		}
+	}
+	b.WriteByte(0x1A)
+	return b.Bytes(), nil
+}
+
+// cell formats a value to exactly the field's width: text is left aligned
+// and cut on a character boundary, numbers are right aligned.
+func cell(field Field, value interface{}) string {
+	if field.Type == Numeric {
+		var s string
+		switch v := value.(type) {
+		case float64:
+			s = fmt.Sprintf("%.*f", field.Decimals, v)
+		case int:
+			s = fmt.Sprintf("%d", v)
+		default:
+			s = fmt.Sprintf("%v", v)
+		}
+		if len(s) > field.Length {
+			s = strings.Repeat("*", field.Length)
+		}
+		return strings.Repeat(" ", field.Length-len(s)) + s
+	}
+	s := fmt.Sprintf("%v", value)
+	for len(s) > field.Length {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s + strings.Repeat(" ", field.Length-len(s))
+}
@@ -0,0 +1,214 @@
+package shp
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testFields = []Field{
+	{Name: "name", Type: Character, Length: 6},
+	{Name: "length_km_total", Type: Numeric, Length: 6, Decimals: 2},
+	{Name: "ways", Type: Numeric, Length: 3},
+}
+
+var testRecords = []Record{
+	{
+		Parts:  [][][]float64{{{-77.45, 39.52}, {-77.44, 39.53}, {-77.42, 39.51}}},
+		Values: []interface{}{"Blue", 2.5, 1},
+	},
+	{
+		Parts: [][][]float64{
+			{{-77.5, 39.6}, {-77.49, 39.61}},
+			{{-77.48, 39.62}, {-77.47, 39.6}},
+		},
+		// the é is two bytes and does not fit, the length overflows
+		Values: []interface{}{"Chemin é", 1234.5, 12},
+	},
+}
+
+// readShape reads a polyline record's content back into parts.
+func readShape(t *testing.T, b []byte) ([4]float64, [][][]float64) {
+	t.Helper()
+	if shapeType := binary.LittleEndian.Uint32(b); shapeType != shapePolyLine {
+		t.Fatalf("shape type = %d, want %d", shapeType, shapePolyLine)
+	}
+	var bbox [4]float64
+	for i := range bbox {
+		bbox[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[4+8*i:]))
+	}
+	numParts := int(binary.LittleEndian.Uint32(b[36:]))
+	numPoints := int(binary.LittleEndian.Uint32(b[40:]))
+	if want := 44 + 4*numParts + 16*numPoints; len(b) != want {
+		t.Fatalf("content is %d bytes for %d parts and %d points, want %d", len(b), numParts, numPoints, want)
+	}
+	starts := make([]int, numParts+1)
+	for i := 0; i < numParts; i++ {
+		starts[i] = int(binary.LittleEndian.Uint32(b[44+4*i:]))
+	}
+	starts[numParts] = numPoints
+	at := 44 + 4*numParts
+	var parts [][][]float64
+	for i := 0; i < numParts; i++ {
+		var part [][]float64
+		for j := starts[i]; j < starts[i+1]; j++ {
+			x := math.Float64frombits(binary.LittleEndian.Uint64(b[at+16*j:]))
+			y := math.Float64frombits(binary.LittleEndian.Uint64(b[at+16*j+8:]))
+			part = append(part, []float64{x, y})
+		}
+		parts = append(parts, part)
+	}
+	return bbox, parts
+}
+
+func checkHeader(t *testing.T, name string, b []byte, bbox [4]float64) {
+	t.Helper()
+	if code := binary.BigEndian.Uint32(b); code != 9994 {
+		t.Errorf("%s file code = %d", name, code)
+	}
+	if words := int(binary.BigEndian.Uint32(b[24:])); words*2 != len(b) {
+		t.Errorf("%s length = %d words, file is %d bytes", name, words, len(b))
+	}
+	if version := binary.LittleEndian.Uint32(b[28:]); version != 1000 {
+		t.Errorf("%s version = %d", name, version)
+	}
+	if shapeType := binary.LittleEndian.Uint32(b[32:]); shapeType != shapePolyLine {
+		t.Errorf("%s shape type = %d", name, shapeType)
+	}
+	var got [4]float64
+	for i := range got {
+		got[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[36+8*i:]))
+	}
+	if got != bbox {
+		t.Errorf("%s bbox = %v, want %v", name, got, bbox)
+	}
+}
+
+func TestWritePolylines(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "trails")
+	if err := WritePolylines(base, testFields, testRecords); err != nil {
+		t.Fatal(err)
+	}
+	read := func(ext string) []byte {
+		b, err := ioutil.ReadFile(base + ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	shp, shx, dbf := read(".shp"), read(".shx"), read(".dbf")
+
+	total := [4]float64{-77.5, 39.51, -77.42, 39.62}
+	checkHeader(t, ".shp", shp, total)
+	checkHeader(t, ".shx", shx, total)
+	if len(shx) != headerBytes+8*len(testRecords) {
+		t.Fatalf(".shx is %d bytes for %d records", len(shx), len(testRecords))
+	}
+
+	// each index entry points at its record in the .shp, and the records
+	// follow each other with nothing between
+	next := headerBytes
+	for i, record := range testRecords {
+		offset := 2 * int(binary.BigEndian.Uint32(shx[headerBytes+8*i:]))
+		length := 2 * int(binary.BigEndian.Uint32(shx[headerBytes+8*i+4:]))
+		if offset != next {
+			t.Errorf("record %d offset = %d, want %d", i, offset, next)
+		}
+		if number := int(binary.BigEndian.Uint32(shp[offset:])); number != i+1 {
+			t.Errorf("record %d number = %d, want %d", i, number, i+1)
+		}
+		if words := 2 * int(binary.BigEndian.Uint32(shp[offset+4:])); words != length {
+			t.Errorf("record %d content length = %d in .shp, %d in .shx", i, words, length)
+		}
+		bbox, parts := readShape(t, shp[offset+8:offset+8+length])
+		if !reflect.DeepEqual(parts, record.Parts) {
+			t.Errorf("record %d parts = %v, want %v", i, parts, record.Parts)
+		}
+		want := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		for _, part := range record.Parts {
+			for _, p := range part {
+				want[0], want[1] = math.Min(want[0], p[0]), math.Min(want[1], p[1])
+				want[2], want[3] = math.Max(want[2], p[0]), math.Max(want[3], p[1])
+			}
+		}
+		if bbox != want {
+			t.Errorf("record %d bbox = %v, want %v", i, bbox, want)
+		}
+		next = offset + 8 + length
+	}
+	if next != len(shp) {
+		t.Errorf("records end at %d, .shp is %d bytes", next, len(shp))
+	}
+
+	if dbf[0] != 0x03 {
+		t.Errorf("dbf version = %x", dbf[0])
+	}
+	count := int(binary.LittleEndian.Uint32(dbf[4:]))
+	headerLength := int(binary.LittleEndian.Uint16(dbf[8:]))
+	recordLength := int(binary.LittleEndian.Uint16(dbf[10:]))
+	if count != len(testRecords) || headerLength != 32+32*len(testFields)+1 || recordLength != 1+6+6+3 {
+		t.Errorf("dbf header = %d records, %d bytes, %d per record", count, headerLength, recordLength)
+	}
+	wantNames := []string{"name", "length_km_", "ways"}
+	for i, field := range testFields {
+		descriptor := dbf[32+32*i : 64+32*i]
+		name := string(descriptor[:10])
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+		if name != wantNames[i] || descriptor[10] != 0 {
+			t.Errorf("field %d name = %q, want %q", i, descriptor[:11], wantNames[i])
+		}
+		if descriptor[11] != field.Type || int(descriptor[16]) != field.Length || int(descriptor[17]) != field.Decimals {
+			t.Errorf("field %d = %c %d.%d, want %c %d.%d", i, descriptor[11], descriptor[16], descriptor[17], field.Type, field.Length, field.Decimals)
+		}
+	}
+	if dbf[headerLength-1] != 0x0D {
+		t.Errorf("field descriptors end with %x", dbf[headerLength-1])
+	}
+	if want := headerLength + count*recordLength + 1; len(dbf) != want || dbf[len(dbf)-1] != 0x1A {
+		t.Errorf("dbf is %d bytes ending %x, want %d ending 1a", len(dbf), dbf[len(dbf)-1], want)
+	}
+	rows := []string{
+		" Blue    2.50  1",
+		" Chemin****** 12",
+	}
+	for i, want := range rows {
+		row := string(dbf[headerLength+i*recordLength : headerLength+(i+1)*recordLength])
+		if row != want {
+			t.Errorf("dbf record %d = %q, want %q", i, row, want)
+		}
+	}
+
+	if prj := string(read(".prj")); prj != wgs84 {
+		t.Errorf(".prj = %s", prj)
+	}
+	if cpg := string(read(".cpg")); cpg != "UTF-8" {
+		t.Errorf(".cpg = %s", cpg)
+	}
+}
+
+func TestCell(t *testing.T) {
+	tests := []struct {
+		field Field
+		value interface{}
+		want  string
+	}{
+		{Field{Type: Character, Length: 5}, "Loop", "Loop "},
+		{Field{Type: Character, Length: 4}, "Loops", "Loop"},
+		// a cut never leaves half a character
+		{Field{Type: Character, Length: 4}, "Allée", "All "},
+		{Field{Type: Character, Length: 6}, "Allée", "Allée"},
+		{Field{Type: Numeric, Length: 6, Decimals: 2}, 3.14159, "  3.14"},
+		{Field{Type: Numeric, Length: 3}, 42, " 42"},
+		{Field{Type: Numeric, Length: 3}, 4200, "***"},
+	}
+	for _, test := range tests {
+		if got := cell(test.field, test.value); got != test.want {
+			t.Errorf("cell(%c %d, %v) = %q, want %q", test.field.Type, test.field.Length, test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package simplify
+
+import (
+	"container/heap"
+	"github.com/mingram/trail/geo"
+	"math"
+)
+
+const (
+	DouglasPeucker = "dp"
+	Visvalingam    = "vw"
+)
+
+var Methods = []string{DouglasPeucker, Visvalingam}
+
+// Line drops points from a [lon, lat, ...] line until it is within tolerance
+// metres of the original. Points marked fixed, and both ends, are always
+// kept so lines still meet at their junctions.
+func Line(points [][]float64, tolerance float64, method string, fixed []bool) [][]float64 {
+	if tolerance <= 0 || len(points) < 3 {
+		return points
+	}
+	var keep []bool
+	if method == Visvalingam {
+		keep = visvalingam(project(points), tolerance, fixed)
+	} else {
+		keep = douglasPeucker(project(points), tolerance, fixed)
+	}
+	var line [][]float64
+	for i, point := range points {
+		if keep[i] {
+			line = append(line, point)
+		}
+	}
+	return line
+}
+
+// project turns lon/lat into metres on a flat plane through the first point,
+// close enough over the length of a trail.
+func project(points [][]float64) [][2]float64 {
+	origin := geo.Point{Lon: points[0][0], Lat: points[0][1]}
+	xy := make([][2]float64, len(points))
+	for i, point := range points {
+		x, y := geo.Flat(origin, geo.Point{Lon: point[0], Lat: point[1]})
+		xy[i] = [2]float64{x, y}
+	}
+	return xy
+}
+
+func anchors(n int, fixed []bool) []bool {
+	keep := make([]bool, n)
+	keep[0], keep[n-1] = true, true
+	for i := range fixed {
+		if i < n && fixed[i] {
+			keep[i] = true
+		}
+	}
+	return keep
+}
+
+func douglasPeucker(xy [][2]float64, tolerance float64, fixed []bool) []bool {
+	keep := anchors(len(xy), fixed)
+	start := 0
+	for i := 1; i < len(xy); i++ {
+		if keep[i] {
+			dpRange(xy, start, i, tolerance, keep)
+			start = i
+		}
+	}
+	return keep
+}
+
+func dpRange(xy [][2]float64, first int, last int, tolerance float64, keep []bool) {
+	if last-first < 2 {
+		return
+	}
+	furthest, furthestDistance := -1, tolerance
+	for i := first + 1; i < last; i++ {
+		if d := segmentDistance(xy[i], xy[first], xy[last]); d > furthestDistance {
+			furthest, furthestDistance = i, d
+		}
+	}
+	if furthest == -1 {
+		return
+	}
+	keep[furthest] = true
+	dpRange(xy, first, furthest, tolerance, keep)
+	dpRange(xy, furthest, last, tolerance, keep)
+}
+
+func segmentDistance(p [2]float64, a [2]float64, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, ((p[0]-a[0])*dx+(p[1]-a[1])*dy)/l))
+	}
+	return math.Hypot(p[0]-a[0]-t*dx, p[1]-a[1]-t*dy)
+}
+
+// visvalingam repeatedly removes the point whose triangle with its
+// neighbours has the smallest area. Only points closer than tolerance to the
+// line between their neighbours are candidates, so tolerance means roughly
+// the same thing as it does for Douglas-Peucker. Triangles wait in a heap;
+// when a removal changes a neighbour's triangle its old entry goes stale and
+// is skipped.
+func visvalingam(xy [][2]float64, tolerance float64, fixed []bool) []bool {
+	n := len(xy)
+	fixedKeep := anchors(n, fixed)
+	keep := make([]bool, n)
+	prev, next := make([]int, n), make([]int, n)
+	version := make([]int, n)
+	for i := range xy {
+		keep[i] = true
+		prev[i], next[i] = i-1, i+1
+	}
+	queue := &triangleQueue{}
+	update := func(i int) {
+		version[i]++
+		if fixedKeep[i] || segmentDistance(xy[i], xy[prev[i]], xy[next[i]]) >= tolerance {
+			return
+		}
+		a, b, c := xy[prev[i]], xy[i], xy[next[i]]
+		area := math.Abs((b[0]-a[0])*(c[1]-a[1])-(c[0]-a[0])*(b[1]-a[1])) / 2
+		heap.Push(queue, triangle{i, area, version[i]})
+	}
+	for i := 1; i < n-1; i++ {
+		update(i)
+	}
+	for queue.Len() > 0 {
+		smallest := heap.Pop(queue).(triangle)
+		i := smallest.point
+		if smallest.version != version[i] {
+			continue
+		}
+		keep[i] = false
+		next[prev[i]] = next[i]
+		prev[next[i]] = prev[i]
+		update(prev[i])
+		update(next[i])
+	}
+	return keep
+}
+
+type triangle struct {
+	point   int
+	area    float64
+	version int
+}
+type triangleQueue []triangle
+
+// Less breaks ties by position so the first of equal triangles goes first.
+func (q triangleQueue) Less(i, j int) bool {
+	if q[i].area != q[j].area {
+		return q[i].area < q[j].area
+	}
+	return q[i].point < q[j].point
+}
+func (q triangleQueue) Len() int            { return len(q) }
+func (q triangleQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *triangleQueue) Push(x interface{}) { *q = append(*q, x.(triangle)) }
+func (q *triangleQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,132 @@
+package simplify
+
+import (
+	"github.com/mingram/trail/geo"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+var origin = geo.Point{Lon: -77.45, Lat: 39.52}
+
+// line turns [east, north] offsets in metres from origin into [lon, lat].
+func line(metres ...[2]float64) [][]float64 {
+	var points [][]float64
+	for _, m := range metres {
+		p := geo.Unflat(origin, m[0], m[1])
+		points = append(points, []float64{p.Lon, p.Lat})
+	}
+	return points
+}
+
+func TestLine(t *testing.T) {
+	// a straight 400 m trail with a 1 m wobble and a 50 m bump
+	wobbly := line([2]float64{0, 0}, [2]float64{100, 1}, [2]float64{200, 0}, [2]float64{300, 50}, [2]float64{400, 0})
+	straight := line([2]float64{0, 0}, [2]float64{100, 0.5}, [2]float64{200, -0.5}, [2]float64{300, 0}, [2]float64{400, 0})
+	tests := []struct {
+		name      string
+		points    [][]float64
+		tolerance float64
+		fixed     []bool
+		want      []int
+	}{
+		{"no tolerance", wobbly, 0, nil, []int{0, 1, 2, 3, 4}},
+		{"too short", wobbly[:2], 5, nil, []int{0, 1}},
+		{"wobble goes, bump stays", wobbly, 5, nil, []int{0, 2, 3, 4}},
+		{"everything goes", wobbly, 100, nil, []int{0, 4}},
+		{"straight", straight, 5, nil, []int{0, 4}},
+		// a junction on a straight stretch is where another trail meets
+		// this one, so it stays
+		{"junction", straight, 5, []bool{false, false, true, false, false}, []int{0, 2, 4}},
+		{"junctions", wobbly, 100, []bool{false, true, false, false, false}, []int{0, 1, 4}},
+	}
+	for _, test := range tests {
+		for _, method := range Methods {
+			got := Line(test.points, test.tolerance, method, test.fixed)
+			var want [][]float64
+			for _, i := range test.want {
+				want = append(want, test.points[i])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s with %s kept %v, want points %v", test.name, method, got, test.want)
+			}
+		}
+	}
+}
+
+// slowVisvalingam is the plain quadratic algorithm, looking through every
+// point for the smallest triangle each time one is removed.
+func slowVisvalingam(xy [][2]float64, tolerance float64, fixed []bool) []bool {
+	n := len(xy)
+	fixedKeep := anchors(n, fixed)
+	keep := make([]bool, n)
+	prev, next := make([]int, n), make([]int, n)
+	for i := range xy {
+		keep[i] = true
+		prev[i], next[i] = i-1, i+1
+	}
+	for {
+		smallest, smallestArea := -1, math.Inf(1)
+		for i := 1; i < n-1; i++ {
+			if !keep[i] || fixedKeep[i] || segmentDistance(xy[i], xy[prev[i]], xy[next[i]]) >= tolerance {
+				continue
+			}
+			a, b, c := xy[prev[i]], xy[i], xy[next[i]]
+			if area := math.Abs((b[0]-a[0])*(c[1]-a[1])-(c[0]-a[0])*(b[1]-a[1])) / 2; area < smallestArea {
+				smallest, smallestArea = i, area
+			}
+		}
+		if smallest == -1 {
+			return keep
+		}
+		keep[smallest] = false
+		next[prev[smallest]] = next[smallest]
+		prev[next[smallest]] = prev[smallest]
+	}
+}
+
+func TestVisvalingamHeap(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	for run := 0; run < 20; run++ {
+		xy := make([][2]float64, 200)
+		fixed := make([]bool, len(xy))
+		for i := range xy {
+			xy[i] = [2]float64{float64(i) * 10, random.NormFloat64() * 5}
+			fixed[i] = random.Intn(20) == 0
+		}
+		for _, tolerance := range []float64{1, 5, 20} {
+			got, want := visvalingam(xy, tolerance, fixed), slowVisvalingam(xy, tolerance, fixed)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("run %d at %g m: heap and quadratic Visvalingam disagree", run, tolerance)
+			}
+			for i := range fixed {
+				if fixed[i] && !got[i] {
+					t.Errorf("run %d at %g m: fixed point %d removed", run, tolerance, i)
+				}
+			}
+		}
+	}
+}
+
+func TestDouglasPeuckerTolerance(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	xy := make([][2]float64, 300)
+	for i := range xy {
+		xy[i] = [2]float64{float64(i) * 5, math.Sin(float64(i)/20)*50 + random.NormFloat64()}
+	}
+	keep := douglasPeucker(xy, 3, nil)
+	// every dropped point is within tolerance of the kept line around it
+	last := 0
+	for i := 1; i < len(xy); i++ {
+		if !keep[i] {
+			continue
+		}
+		for j := last + 1; j < i; j++ {
+			if d := segmentDistance(xy[j], xy[last], xy[i]); d > 3 {
+				t.Errorf("point %d is %f m from the simplified line", j, d)
+			}
+		}
+		last = i
+	}
+}
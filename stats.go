@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mingram/trail/osm"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Totals are the numbers the stats command reports for one trail, all the
+// ways sharing its name, or for one activity.
+type Totals struct {
+	Name string `json:"name"`
+	// Activities is only set for trails
+	Activities string  `json:"activities,omitempty"`
+	Km         float64 `json:"km"`
+	Segments   int     `json:"segments"`
+	// Surfaces and Difficulties are km by value
+	Surfaces     map[string]float64 `json:"surfaces"`
+	Difficulties map[string]float64 `json:"difficulties"`
+	// BBox is minLon, minLat, maxLon, maxLat
+	BBox [4]float64 `json:"bbox"`
+}
+
+type Stats struct {
+	Trails     []Totals `json:"trails"`
+	Activities []Totals `json:"activities"`
+}
+
+func newTotals(name string) *Totals {
+	return &Totals{
+		Name:         name,
+		Surfaces:     make(map[string]float64),
+		Difficulties: make(map[string]float64),
+		BBox:         [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)},
+	}
+}
+
+func (t *Totals) add(node []openStreetMap.Node, km float64, difficulty string) {
+	t.Km += km
+	t.Segments++
+	t.Surfaces[trailSurface(node[0])] += km
+	if difficulty == "" || difficulty == "none" {
+		difficulty = "unrated"
+	}
+	t.Difficulties[difficulty] += km
+	for _, nd := range node {
+		t.BBox[0], t.BBox[1] = math.Min(t.BBox[0], nd.Lon), math.Min(t.BBox[1], nd.Lat)
+		t.BBox[2], t.BBox[3] = math.Max(t.BBox[2], nd.Lon), math.Max(t.BBox[3], nd.Lat)
+	}
+}
+
+func trailSurface(node openStreetMap.Node) string {
+	if node.Mtnbike.Surface != "" && node.Mtnbike.Surface != "unknown" {
+		return node.Mtnbike.Surface
+	}
+	if node.Foot.Surface != "" {
+		return node.Foot.Surface
+	}
+	return "unknown"
+}
+
+// activityDifficulty is the rating a trail has for one activity.
+func activityDifficulty(node openStreetMap.Node, activity string) string {
+	switch activity {
+	case "Bike":
+		return node.Mtnbike.Diff
+	case "Ski":
+		return node.Ski.Diff
+	case "Hike":
+		return node.Foot.Diff
+	}
+	return ""
+}
+
+// trailStats adds the ways up by trail name and by activity, a way that
+// allows several activities counting toward each of them.
+func (opts exportOptions) trailStats(nodes [][]openStreetMap.Node) Stats {
+	trails := make(map[string]*Totals)
+	activities := make(map[string]*Totals)
+	var names []string
+	trailActivities := make(map[string]map[string]bool)
+	for _, node := range nodes {
+		km := opts.trailLength(node)
+		name := node[0].Name
+		if name == "" {
+			name = "Unnamed"
+		}
+		if trails[name] == nil {
+			trails[name] = newTotals(name)
+			trailActivities[name] = make(map[string]bool)
+			names = append(names, name)
+		}
+		trails[name].add(node, km, trailDifficulty(node[0]))
+
+		_, tipo := GetColor(node[0])
+		for _, activity := range strings.Split(tipo, ", ") {
+			trailActivities[name][activity] = true
+			if activities[activity] == nil {
+				activities[activity] = newTotals(activity)
+			}
+			activities[activity].add(node, km, activityDifficulty(node[0], activity))
+		}
+	}
+
+	var stats Stats
+	sort.Strings(names)
+	for _, name := range names {
+		var list []string
+		for activity := range trailActivities[name] {
+			list = append(list, activity)
+		}
+		sort.Strings(list)
+		trails[name].Activities = strings.Join(list, ", ")
+		stats.Trails = append(stats.Trails, *trails[name])
+	}
+	var kinds []string
+	for activity := range activities {
+		kinds = append(kinds, activity)
+	}
+	sort.Strings(kinds)
+	for _, activity := range kinds {
+		stats.Activities = append(stats.Activities, *activities[activity])
+	}
+	return stats
+}
+
+// breakdown formats km by value as "dirt: 1.20 km, gravel: 0.30 km", biggest
+// first.
+func breakdown(values map[string]float64, sep string) string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if values[keys[i]] != values[keys[j]] {
+			return values[keys[i]] > values[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	var parts []string
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %.2f km", key, values[key]))
+	}
+	return strings.Join(parts, sep)
+}
+
+func bboxString(b [4]float64) string {
+	return fmt.Sprintf("%f,%f,%f,%f", b[0], b[1], b[2], b[3])
+}
+
+// WriteMarkdown writes the trail and activity tables, what the stats
+// command prints.
+func (stats Stats) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	table := func(title string, rows []Totals) {
+		b.WriteString("## " + title + "\n\n")
+		b.WriteString("| Name | Activities | Length (km) | Segments | Surface | Difficulty | Bounding box |\n")
+		b.WriteString("|---|---|---:|---:|---|---|---|\n")
+		for _, t := range rows {
+			name := strings.Replace(t.Name, "|", "\\|", -1)
+			b.WriteString(fmt.Sprintf("| %s | %s | %.2f | %d | %s | %s | %s |\n",
+				name, t.Activities, t.Km, t.Segments, breakdown(t.Surfaces, ", "), breakdown(t.Difficulties, ", "), bboxString(t.BBox)))
+		}
+		b.WriteString("\n")
+	}
+	table("Trails", stats.Trails)
+	table("Activities", stats.Activities)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteCSV puts trails and activities in one table, told apart by the
+// level column.
+func (stats Stats) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"level", "name", "activities", "km", "segments", "surfaces", "difficulties", "min_lon", "min_lat", "max_lon", "max_lat"})
+	for _, level := range []struct {
+		name string
+		rows []Totals
+	}{{"trail", stats.Trails}, {"activity", stats.Activities}} {
+		for _, t := range level.rows {
+			c.Write([]string{
+				level.name, t.Name, t.Activities, fmt.Sprintf("%.3f", t.Km), fmt.Sprintf("%d", t.Segments),
+				breakdown(t.Surfaces, "; "), breakdown(t.Difficulties, "; "),
+				fmt.Sprintf("%f", t.BBox[0]), fmt.Sprintf("%f", t.BBox[1]), fmt.Sprintf("%f", t.BBox[2]), fmt.Sprintf("%f", t.BBox[3]),
+			})
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// SaveFile writes JSON, Markdown or CSV depending on the file extension,
+// CSV being the default.
+func (stats Stats) SaveFile(file string) error {
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".json" {
+		json, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, json, 0644)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if ext == ".md" || ext == ".markdown" {
+		err = stats.WriteMarkdown(f)
+	} else {
+		err = stats.WriteCSV(f)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
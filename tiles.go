@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/mingram/trail/mvt"
+	"github.com/mingram/trail/osm"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// trailDifficulty is the rating for whichever activity the trail has one for.
+func trailDifficulty(node openStreetMap.Node) string {
+	if node.Mtnbike.Diff != "" {
+		return node.Mtnbike.Diff
+	}
+	if node.Ski.Diff != "" {
+		return node.Ski.Diff
+	}
+	if node.Foot.Diff != "none" {
+		return node.Foot.Diff
+	}
+	return ""
+}
+
+// writeTiles saves the trails as vector tiles, into an MBTiles file when out
+// ends in .mbtiles and a z/x/y directory otherwise.
+func (opts exportOptions) writeTiles(out string, nodes [][]openStreetMap.Node, minZoom int, maxZoom int) error {
+	var features []mvt.Feature
+	bounds := [4]float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, node := range nodes {
+		color, tipo := GetColor(node[0])
+		properties := map[string]interface{}{
+			"name":     node[0].Name,
+			"activity": tipo,
+			"color":    color,
+		}
+		if diff := trailDifficulty(node[0]); diff != "" {
+			properties["difficulty"] = diff
+		}
+		if node[0].Park != "" {
+			properties["park"] = node[0].Park
+		}
+		if node[0].Segment != "" {
+			properties["segment"] = node[0].Segment
+		}
+		var coordinates [][]float64
+		for _, nd := range node {
+			coordinates = append(coordinates, []float64{nd.Lon, nd.Lat})
+			bounds[0], bounds[1] = math.Min(bounds[0], nd.Lon), math.Min(bounds[1], nd.Lat)
+			bounds[2], bounds[3] = math.Max(bounds[2], nd.Lon), math.Max(bounds[3], nd.Lat)
+		}
+		features = append(features, mvt.Feature{Id: opts.tileId(node), Coordinates: coordinates, Properties: properties})
+	}
+
+	tiles := mvt.Build("trails", features, minZoom, maxZoom)
+	log.Print("Number of tiles: " + strconv.Itoa(len(tiles)))
+	if !strings.HasSuffix(out, ".mbtiles") {
+		return mvt.WriteDir(out, tiles)
+	}
+	return mvt.WriteMBTiles(out, tiles, mvt.Metadata{
+		Name:  "Trails",
+		Layer: "trails",
+		Fields: map[string]string{
+			"name":       "String",
+			"activity":   "String",
+			"color":      "String",
+			"difficulty": "String",
+			"park":       "String",
+			"segment":    "String",
+		},
+		MinZoom: minZoom,
+		MaxZoom: maxZoom,
+		Bounds:  bounds,
+	})
+}
@@ -0,0 +1,137 @@
+package units
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+
+	kmPerMile     = 1.609344
+	metresPerFoot = 0.3048
+)
+
+var Systems = []string{Metric, Imperial}
+
+// separators are the decimal and thousands separators for each locale.
+var separators = map[string][2]string{
+	"en": {".", ","},
+	"de": {",", "."},
+	"es": {",", "."},
+	"fr": {",", " "},
+	"it": {",", "."},
+	"nl": {",", "."},
+}
+
+// Locales lists the locales numbers can be written for.
+func Locales() []string {
+	var locales []string
+	for locale := range separators {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Units turns raw km and metres into text for people to read.
+type Units struct {
+	System string
+	Locale string
+	// Decimals fixes the number of decimal places; when negative they are
+	// picked from the size of the number
+	Decimals int
+}
+
+// New checks system and locale; the locale is a language code, any
+// region after it being ignored.
+func New(system string, locale string, decimals int) (Units, error) {
+	if system != Metric && system != Imperial {
+		return Units{}, fmt.Errorf("unknown unit system %q, want one of %s", system, strings.Join(Systems, ", "))
+	}
+	// en-US, en_GB and so on all write numbers the same way as en
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	locale = strings.ToLower(locale)
+	if _, ok := separators[locale]; !ok {
+		return Units{}, fmt.Errorf("unknown locale %q, want one of %s", locale, strings.Join(Locales(), ", "))
+	}
+	return Units{System: system, Locale: locale, Decimals: decimals}, nil
+}
+
+// Number formats v with the locale's separators.
+func (u Units) Number(v float64, decimals int) string {
+	sep, ok := separators[u.Locale]
+	if !ok {
+		sep = separators["en"]
+	}
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	whole, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(sep[1])
+		}
+		b.WriteRune(r)
+	}
+	if fraction != "" {
+		b.WriteString(sep[0] + fraction)
+	}
+	return b.String()
+}
+
+func (u Units) decimals(v float64) int {
+	if u.Decimals >= 0 {
+		return u.Decimals
+	}
+	if v < 100 {
+		return 1
+	}
+	return 0
+}
+
+// Distance writes a length given in km: "3.4 mi" or "5.6 km", dropping to
+// feet or metres, to the nearest 10, for anything too short to read well
+// that way.
+func (u Units) Distance(km float64) string {
+	if u.System == Imperial {
+		miles := km / kmPerMile
+		if miles < 0.1 {
+			return u.Number(math.Round(km*1000/metresPerFoot/10)*10, 0) + " ft"
+		}
+		return u.Number(miles, u.decimals(miles)) + " mi"
+	}
+	if km < 1 {
+		return u.Number(math.Round(km*100)*10, 0) + " m"
+	}
+	return u.Number(km, u.decimals(km)) + " km"
+}
+
+// Height writes a height or climb given in metres, to the nearest 10 ft or
+// the nearest metre.
+func (u Units) Height(metres float64) string {
+	if u.System == Imperial {
+		return u.Number(math.Round(metres/metresPerFoot/10)*10, 0) + " ft"
+	}
+	return u.Number(math.Round(metres), 0) + " m"
+}
+
+// Funcs are the template functions description templates can use.
+func (u Units) Funcs() map[string]interface{} {
+	return map[string]interface{}{
+		"distance": u.Distance,
+		"height":   u.Height,
+		"number":   u.Number,
+	}
+}
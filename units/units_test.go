@@ -0,0 +1,111 @@
+package units
+
+import (
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		system string
+		locale string
+		want   string
+		ok     bool
+	}{
+		{Metric, "en", "en", true},
+		{Imperial, "en-US", "en", true},
+		{Metric, "fr_CA", "fr", true},
+		{Metric, "DE", "de", true},
+		{"nautical", "en", "", false},
+		{Metric, "pt-BR", "", false},
+	}
+	for _, test := range tests {
+		u, err := New(test.system, test.locale, -1)
+		if (err == nil) != test.ok || u.Locale != test.want {
+			t.Errorf("New(%q, %q) = %q, %v, want %q, ok %v", test.system, test.locale, u.Locale, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		locale   string
+		v        float64
+		decimals int
+		want     string
+	}{
+		{"en", 1234567.891, 2, "1,234,567.89"},
+		{"de", 1234567.891, 2, "1.234.567,89"},
+		// French groups thousands with a narrow no-break space
+		{"fr", 1234567.891, 2, "1\u202f234\u202f567,89"},
+		{"es", 1234.5, 1, "1.234,5"},
+		{"en", 999, 0, "999"},
+		{"en", 1000, 0, "1,000"},
+		{"de", 0.5, 1, "0,5"},
+		{"en", -1234.5, 1, "-1,234.5"},
+		// rounding to zero drops the sign
+		{"en", -0.04, 1, "0.0"},
+		// an unknown locale writes English numbers
+		{"xx", 1234.5, 1, "1,234.5"},
+	}
+	for _, test := range tests {
+		if got := (Units{Locale: test.locale}).Number(test.v, test.decimals); got != test.want {
+			t.Errorf("Number(%v, %d) in %s = %q, want %q", test.v, test.decimals, test.locale, got, test.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		system   string
+		locale   string
+		decimals int
+		km       float64
+		want     string
+	}{
+		{Metric, "en", -1, 5.64, "5.6 km"},
+		{Metric, "en", -1, 123.4, "123 km"},
+		{Metric, "en", 2, 5.6, "5.60 km"},
+		{Metric, "en", -1, 0.456, "460 m"},
+		{Metric, "de", -1, 1234.6, "1.235 km"},
+		{Imperial, "en", -1, kmPerMile * 3.4, "3.4 mi"},
+		{Imperial, "en", -1, kmPerMile * 250, "250 mi"},
+		{Imperial, "en", 2, 10, "6.21 mi"},
+		// under a tenth of a mile is feet, to the nearest 10
+		{Imperial, "en", -1, 0.1, "330 ft"},
+		{Imperial, "en", -1, kmPerMile * 0.11, "0.1 mi"},
+		{Imperial, "fr", -1, kmPerMile * 1234.6, "1\u202f235 mi"},
+	}
+	for _, test := range tests {
+		u, err := New(test.system, test.locale, test.decimals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.Distance(test.km); got != test.want {
+			t.Errorf("Distance(%v) in %s %s = %q, want %q", test.km, test.system, test.locale, got, test.want)
+		}
+	}
+}
+
+func TestHeight(t *testing.T) {
+	tests := []struct {
+		system string
+		locale string
+		metres float64
+		want   string
+	}{
+		{Metric, "en", 123.4, "123 m"},
+		{Metric, "de", 1234.5, "1.235 m"},
+		{Imperial, "en", 100, "330 ft"},
+		{Imperial, "en", 1000, "3,280 ft"},
+		{Imperial, "nl", 1000, "3.280 ft"},
+	}
+	for _, test := range tests {
+		u, err := New(test.system, test.locale, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u.Height(test.metres); got != test.want {
+			t.Errorf("Height(%v) in %s %s = %q, want %q", test.metres, test.system, test.locale, got, test.want)
+		}
+	}
+}